@@ -0,0 +1,611 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// unit-aware calculator used by the root command, ex:
+//   mt 3 cups + 200 mL in L
+//   mt (12 ft * 9 ft) to m^2
+
+// units is a product of named units each raised to some power
+type units map[string]int
+
+// quantity is an amount with the units it is measured in
+type quantity struct {
+	value interval
+	units units
+}
+
+func (u units) copy() units {
+	out := make(units)
+	for name, pow := range u {
+		if pow != 0 {
+			out[name] = pow
+		}
+	}
+	return out
+}
+
+func (u units) mul(u2 units, sign int) units {
+	out := u.copy()
+	for name, pow := range u2 {
+		out[name] += sign * pow
+		if out[name] == 0 {
+			delete(out, name)
+		}
+	}
+	return out
+}
+
+func (u units) dimensionless() bool {
+	return len(u.copy()) == 0
+}
+
+// String returns the canonical form of the units, ex. "ft^2" or "m/s"
+func (u units) String() string {
+	var names []string
+	for name, pow := range u {
+		if pow != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var num, den []string
+	for _, name := range names {
+		pow := u[name]
+		abs := pow
+		if abs < 0 {
+			abs = -abs
+		}
+		s := name
+		if abs != 1 {
+			s += "^" + strconv.Itoa(abs)
+		}
+		if pow > 0 {
+			num = append(num, s)
+		} else {
+			den = append(den, s)
+		}
+	}
+	out := strings.Join(num, "*")
+	if len(den) > 0 {
+		if out == "" {
+			out = "1"
+		}
+		out += "/" + strings.Join(den, "/")
+	}
+	return out
+}
+
+func (q quantity) String() string {
+	s := q.value.format(formatAmount)
+	if us := q.units.String(); us != "" {
+		s += " " + us
+	}
+	return s
+}
+
+// formatAmount prints the amount to the decimal places set by flag, otherwise
+// to ten significant figures
+func formatAmount(amount float64) string {
+	if decimalPlacesFromFlag != -1 {
+		return strconv.FormatFloat(amount, 'f', decimalPlacesFromFlag, 64)
+	}
+	return strconv.FormatFloat(amount, 'g', 10, 64)
+}
+
+// knownUnit resolves aliases and plurals to a unit found in the unit registry
+// or equivalences
+func knownUnit(name string) (string, bool) {
+	if u, ok := unitAlias[name]; ok {
+		name = u
+	}
+	if u, ok := lookupUnit(name); ok {
+		return u.name, true
+	}
+	if isEquivalenceUnit(name) {
+		return name, true
+	}
+	if strings.HasSuffix(name, "s") {
+		return knownUnit(strings.TrimSuffix(name, "s"))
+	}
+	return "", false
+}
+
+// def combines the units into a single unit definition, only a lone unit may
+// have an offset (such as C)
+func (u units) def() (unitDef, bool) {
+	out := unitDef{name: u.String(), factor: 1}
+	for name, pow := range u {
+		ud, found := lookupUnit(name)
+		if !found {
+			return unitDef{}, false
+		}
+		if ud.offset != 0 {
+			if len(u) != 1 || pow != 1 {
+				return unitDef{}, false
+			}
+			return ud, true
+		}
+		ud = ud.pow(pow)
+		out.dim = out.dim.mul(ud.dim, 1)
+		out.factor *= ud.factor
+	}
+	return out, true
+}
+
+// convertQuantity expresses the quantity in the target units
+func convertQuantity(q quantity, to units) (quantity, error) {
+	from := q.units
+	if from.String() == to.String() {
+		return quantity{q.value, to.copy()}, nil
+	}
+
+	fromDef, okF := from.def()
+	toDef, okT := to.def()
+	if okF && okT {
+		if fromDef.dim != toDef.dim {
+			return quantity{}, fmt.Errorf("incompatible units: %v (%v) and %v (%v)",
+				from, fromDef.dim, to, toDef.dim)
+		}
+		factor := fromDef.factor / toDef.factor
+		offset := (fromDef.offset - toDef.offset) / toDef.factor
+		step := conversionStep{from.String(), to.String(), factor, factor, offset, "units"}
+		return quantity{step.apply(q.value), to.copy()}, nil
+	}
+
+	// lone units which aren't registered may still have equivalences
+	if len(from) == 1 && len(to) == 1 {
+		path, err := getConversionPath(from.String(), to.String(), "")
+		if err == nil {
+			return quantity{composeSteps(path).apply(q.value), to.copy()}, nil
+		}
+	}
+	return quantity{}, fmt.Errorf("incompatible units: %v and %v", from, to)
+}
+
+//_______________________________________________________________________
+// arithmetic
+
+func addQuantities(a, b quantity, sign float64) (quantity, error) {
+	bConv, err := convertQuantity(b, a.units)
+	if err != nil {
+		return quantity{}, fmt.Errorf("cannot add %v and %v: %v", a, b, err)
+	}
+	if sign < 0 {
+		return quantity{a.value.sub(bConv.value), a.units.copy()}, nil
+	}
+	return quantity{a.value.add(bConv.value), a.units.copy()}, nil
+}
+
+func mulQuantities(a, b quantity, sign int) (quantity, error) {
+
+	// bring matching units of b into the units of a, ex. ft*in -> ft^2
+	bUnits := b.units.copy()
+	bValue := b.value
+	for name, pow := range b.units {
+		if _, found := a.units[name]; found {
+			continue
+		}
+		for aName := range a.units {
+			factor, ok := linearFactorBetween(name, aName)
+			if !ok {
+				continue
+			}
+			bValue = bValue.scale(math.Pow(factor, float64(pow)))
+			delete(bUnits, name)
+			bUnits[aName] += pow
+			break
+		}
+	}
+
+	if sign < 0 {
+		v, err := a.value.div(bValue)
+		if err != nil {
+			return quantity{}, err
+		}
+		return quantity{v, a.units.mul(bUnits, -1)}, nil
+	}
+	return quantity{a.value.mul(bValue), a.units.mul(bUnits, 1)}, nil
+}
+
+func powQuantity(a, b quantity) (quantity, error) {
+	if !b.units.dimensionless() {
+		return quantity{}, fmt.Errorf("exponent %v must be dimensionless", b)
+	}
+	if !b.value.isExact() {
+		return quantity{}, fmt.Errorf("exponent %v must be a precise amount", b)
+	}
+	exp := b.value.lo
+	if a.units.dimensionless() {
+		return quantity{a.value.pow(exp), units{}}, nil
+	}
+	if exp != math.Trunc(exp) {
+		return quantity{}, fmt.Errorf("cannot raise %v to non-integer power %v", a, exp)
+	}
+	pow := int(exp)
+	out := make(units)
+	for name, p := range a.units {
+		out[name] = p * pow
+	}
+	return quantity{a.value.pow(exp), out.copy()}, nil
+}
+
+//_______________________________________________________________________
+// parsing
+
+type calcTokenKind int
+
+const (
+	tokNumber calcTokenKind = iota
+	tokIdent
+	tokOp
+	tokEOF
+)
+
+type calcToken struct {
+	kind calcTokenKind
+	text string
+}
+
+func tokenizeCalc(input string) ([]calcToken, error) {
+	var toks []calcToken
+	rs := []rune(input)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			// scientific notation, ex. 1e3 or 2.5E-4
+			if j < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+				k := j + 1
+				if k < len(rs) && (rs[k] == '-' || rs[k] == '+') {
+					k++
+				}
+				if k < len(rs) && unicode.IsDigit(rs[k]) {
+					for k < len(rs) && unicode.IsDigit(rs[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			toks = append(toks, calcToken{tokNumber, string(rs[i:j])})
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(rs) {
+				if unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) {
+					j++
+					continue
+				}
+				// allow hyphenated names, ex. baking-soda
+				if rs[j] == '-' && j+1 < len(rs) && unicode.IsLetter(rs[j+1]) {
+					j++
+					continue
+				}
+				break
+			}
+			toks = append(toks, calcToken{tokIdent, string(rs[i:j])})
+			i = j
+		case strings.ContainsRune("+-*/^()", r):
+			toks = append(toks, calcToken{tokOp, string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return append(toks, calcToken{kind: tokEOF}), nil
+}
+
+type calcParser struct {
+	toks []calcToken
+	pos  int
+
+	// variables which may be referenced within the expression, ignored when
+	// parsing the target units
+	vars      map[string]quantity
+	unitsOnly bool
+}
+
+func (p *calcParser) peek() calcToken { return p.toks[p.pos] }
+
+func (p *calcParser) next() calcToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *calcParser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+// atTarget reports whether the next token begins the target unit. As "in" is
+// also the unit for inches it is only treated as a keyword when followed by
+// another unit.
+func (p *calcParser) atTarget() bool {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return false
+	}
+	switch t.text {
+	case "to":
+		return true
+	case "in":
+		after := p.toks[p.pos+1]
+		return after.kind == tokIdent && after.text != "to" && after.text != "in"
+	}
+	return false
+}
+
+// evalUnitExpr evaluates an expression with units, optionally followed by
+// "in <unit>" or "to <unit>"
+func evalUnitExpr(input string) (quantity, error) {
+	return evalUnitExprWithVars(input, nil)
+}
+
+// evalUnitExprWithVars evaluates an expression which may reference variables
+func evalUnitExprWithVars(input string, vars map[string]quantity) (quantity, error) {
+	toks, err := tokenizeCalc(input)
+	if err != nil {
+		return quantity{}, err
+	}
+	p := &calcParser{toks: toks, vars: vars}
+	q, err := p.parseSum()
+	if err != nil {
+		return quantity{}, err
+	}
+	if p.atTarget() {
+		p.next()
+		p.unitsOnly = true
+		target, err := p.parseSum()
+		if err != nil {
+			return quantity{}, err
+		}
+		if target.value != exact(1) {
+			return quantity{}, errors.New("target must be a unit without an amount")
+		}
+		q, err = convertQuantity(q, target.units)
+		if err != nil {
+			return quantity{}, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return quantity{}, fmt.Errorf("unexpected %q", t.text)
+	}
+	return q, nil
+}
+
+func (p *calcParser) parseSum() (quantity, error) {
+	q, err := p.parseProduct()
+	if err != nil {
+		return quantity{}, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		sign := 1.0
+		if p.next().text == "-" {
+			sign = -1
+		}
+		rhs, err := p.parseProduct()
+		if err != nil {
+			return quantity{}, err
+		}
+		q, err = addQuantities(q, rhs, sign)
+		if err != nil {
+			return quantity{}, err
+		}
+	}
+	return q, nil
+}
+
+func (p *calcParser) parseProduct() (quantity, error) {
+	q, err := p.parseUnary()
+	if err != nil {
+		return quantity{}, err
+	}
+	for p.isOp("*") || p.isOp("/") {
+		sign := 1
+		if p.next().text == "/" {
+			sign = -1
+		}
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return quantity{}, err
+		}
+		q, err = mulQuantities(q, rhs, sign)
+		if err != nil {
+			return quantity{}, err
+		}
+	}
+	return q, nil
+}
+
+func (p *calcParser) parseUnary() (quantity, error) {
+	if p.isOp("-") {
+		p.next()
+		q, err := p.parseUnary()
+		q.value = q.value.neg()
+		return q, err
+	}
+	if p.isOp("+") {
+		p.next()
+	}
+	return p.parsePower()
+}
+
+func (p *calcParser) parsePower() (quantity, error) {
+	q, err := p.parsePrimary()
+	if err != nil {
+		return quantity{}, err
+	}
+	if p.isOp("^") {
+		p.next()
+		exp, err := p.parseUnary()
+		if err != nil {
+			return quantity{}, err
+		}
+		return powQuantity(q, exp)
+	}
+	return q, nil
+}
+
+func (p *calcParser) parsePrimary() (quantity, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokNumber:
+
+		// a range of amounts may be given as lo..hi, ex. 2..3 lemons
+		var value interval
+		for i, numStr := range strings.SplitN(t.text, "..", 2) {
+			v, err := strconv.ParseFloat(numStr, 64)
+			if err != nil {
+				return quantity{}, err
+			}
+			if i == 0 {
+				value = exact(v)
+			} else {
+				value = bounds(value.lo, v)
+			}
+		}
+		q := quantity{value, units{}}
+
+		// units directly following a number bind to it, ex. 3 ft^2
+		for p.peek().kind == tokIdent && !p.atTarget() {
+			u, err := p.parsePower()
+			if err != nil {
+				return quantity{}, err
+			}
+			q, err = mulQuantities(q, u, 1)
+			if err != nil {
+				return quantity{}, err
+			}
+		}
+		return q, nil
+
+	case t.kind == tokIdent:
+		if !p.unitsOnly {
+			if fn, found := calcFunctions[t.text]; found && p.isOp("(") {
+				arg, err := p.parsePrimary()
+				if err != nil {
+					return quantity{}, err
+				}
+				return fn(arg)
+			}
+			if q, found := p.vars[t.text]; found {
+				return q, nil
+			}
+			if v, found := calcConstants[t.text]; found {
+				return quantity{exact(v), units{}}, nil
+			}
+		}
+		name, ok := knownUnit(t.text)
+		if !ok {
+			return quantity{}, fmt.Errorf("unknown unit %q", t.text)
+		}
+		return quantity{exact(1), units{name: 1}}, nil
+
+	case t.kind == tokOp && t.text == "(":
+		q, err := p.parseSum()
+		if err != nil {
+			return quantity{}, err
+		}
+		if !p.isOp(")") {
+			return quantity{}, errors.New("missing closing parenthesis")
+		}
+		p.next()
+		return q, nil
+
+	case t.kind == tokEOF:
+		return quantity{}, errors.New("unexpected end of expression")
+	}
+	return quantity{}, fmt.Errorf("unexpected %q", t.text)
+}
+
+//_______________________________________________________________________
+// functions
+
+var calcConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var calcFunctions = map[string]func(quantity) (quantity, error){
+	"sqrt":  sqrtQuantity,
+	"abs":   absQuantity,
+	"floor": keepUnitsFn(math.Floor),
+	"ceil":  keepUnitsFn(math.Ceil),
+	"round": keepUnitsFn(math.Round),
+	"exp":   dimensionlessFn("exp", math.Exp, true),
+	"ln":    dimensionlessFn("ln", math.Log, true),
+	"log":   dimensionlessFn("log", math.Log10, true),
+	"log2":  dimensionlessFn("log2", math.Log2, true),
+	"sin":   dimensionlessFn("sin", math.Sin, false),
+	"cos":   dimensionlessFn("cos", math.Cos, false),
+	"tan":   dimensionlessFn("tan", math.Tan, false),
+	"asin":  dimensionlessFn("asin", math.Asin, true),
+	"acos":  dimensionlessFn("acos", math.Acos, true),
+	"atan":  dimensionlessFn("atan", math.Atan, true),
+}
+
+// dimensionlessFn applies a function to a dimensionless quantity, functions
+// which aren't monotonic may only be applied to precise amounts
+func dimensionlessFn(name string, fn func(float64) float64, monotonic bool) func(quantity) (quantity, error) {
+	return func(q quantity) (quantity, error) {
+		if !q.units.dimensionless() {
+			return quantity{}, fmt.Errorf("%v requires a dimensionless amount, not %v", name, q)
+		}
+		if !monotonic && !q.value.isExact() {
+			return quantity{}, fmt.Errorf("%v requires a precise amount, not %v", name, q)
+		}
+		v := bounds(fn(q.value.lo), fn(q.value.hi))
+		if math.IsNaN(v.lo) || math.IsNaN(v.hi) {
+			return quantity{}, fmt.Errorf("%v is undefined for %v", name, q)
+		}
+		return quantity{v, units{}}, nil
+	}
+}
+
+// keepUnitsFn applies a monotonic function to the amount keeping its units
+func keepUnitsFn(fn func(float64) float64) func(quantity) (quantity, error) {
+	return func(q quantity) (quantity, error) {
+		return quantity{bounds(fn(q.value.lo), fn(q.value.hi)), q.units.copy()}, nil
+	}
+}
+
+func absQuantity(q quantity) (quantity, error) {
+	v := bounds(math.Abs(q.value.lo), math.Abs(q.value.hi))
+	if q.value.lo < 0 && q.value.hi > 0 {
+		v.lo = 0
+	}
+	return quantity{v, q.units.copy()}, nil
+}
+
+// sqrtQuantity halves the power of each unit, ex. sqrt(9 m^2) = 3 m
+func sqrtQuantity(q quantity) (quantity, error) {
+	if q.value.lo < 0 {
+		return quantity{}, fmt.Errorf("sqrt is undefined for %v", q)
+	}
+	out := make(units)
+	for name, pow := range q.units {
+		if pow%2 != 0 {
+			return quantity{}, fmt.Errorf("cannot take the sqrt of %v", q.units)
+		}
+		out[name] = pow / 2
+	}
+	return quantity{q.value.pow(0.5), out}, nil
+}
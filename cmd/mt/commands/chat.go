@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// chat transcripts, text copied from a chat app is parsed by the parser of
+// its format into messages which are rendered as markdown, text or json
+var (
+	ChatCmd = &cobra.Command{
+		Use:   "chat",
+		Short: "chat log commands",
+	}
+	ChatCleanCmd = &cobra.Command{
+		Use:   "clean [names...]",
+		Short: "From/to clipboard - chat text as a markdown, text or json transcript",
+		Long: `From/to clipboard - chat text as a markdown, text or json transcript
+
+The format of the chat is set with --from as one of discord, irc, matrix,
+slack or teams. The text may instead be read from and written to files or
+stdin/stdout with --in and --out, which is the default where there's no
+clipboard. Names may be provided for speakers which the parser otherwise
+wouldn't recognize, such as names on a line of their own.`,
+		RunE: chatCleanCmd,
+	}
+)
+
+var (
+	chatIO                   textIO
+	chatFromFlag             string
+	transcriptFormatFromFlag string
+	timestampsFromFlag       bool
+)
+
+func init() {
+	ChatCleanCmd.PersistentFlags().StringVar(&chatFromFlag, "from", "slack",
+		"format of the chat: "+strings.Join(chatFormats(), ", "))
+	addTranscriptFlags(ChatCleanCmd, &chatIO)
+	ChatCmd.AddCommand(ChatCleanCmd)
+	RootCmd.AddCommand(ChatCmd)
+}
+
+// addTranscriptFlags registers the flags shared by the chat commands
+func addTranscriptFlags(cmd *cobra.Command, tio *textIO) {
+	cmd.PersistentFlags().StringVarP(&transcriptFormatFromFlag, "format", "f", "markdown",
+		"transcript format: markdown, text or json")
+	cmd.PersistentFlags().BoolVar(&timestampsFromFlag, "timestamps", false,
+		"keep the message times within markdown and text transcripts")
+	addTextIOFlags(cmd, tio, true)
+}
+
+// chatParser parses the text of a chat format, names are speakers which
+// may otherwise be unrecognized
+type chatParser func(text string, names []string) []chatMessage
+
+var chatParsers = map[string]chatParser{
+	"discord": parseDiscord,
+	"irc":     parseIRC,
+	"matrix":  parseMatrix,
+	"slack":   parseSlack,
+	"teams":   parseTeams,
+}
+
+func chatFormats() []string {
+	var formats []string
+	for format := range chatParsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func chatCleanCmd(cmd *cobra.Command, args []string) error {
+	return cleanChat(chatFromFlag, chatIO, args)
+}
+
+// cleanChat reads, parses and renders the chat
+func cleanChat(from string, tio textIO, names []string) error {
+	parse, found := chatParsers[from]
+	if !found {
+		return fmt.Errorf("unknown chat format %v, must be one of %v",
+			from, strings.Join(chatFormats(), ", "))
+	}
+	text, err := tio.read()
+	if err != nil {
+		return err
+	}
+
+	msgs := parse(text, names)
+	out, err := renderTranscript(msgs, transcriptFormatFromFlag, timestampsFromFlag)
+	if err != nil {
+		return err
+	}
+	if err := tio.write(out); err != nil {
+		return err
+	}
+
+	tio.status("Processed successfully, %d messages", len(msgs))
+	return nil
+}
+
+// chatMessage is a single message of a transcript
+type chatMessage struct {
+	Speaker   string     `json:"speaker"`
+	Time      string     `json:"time,omitempty"`
+	Text      string     `json:"text"`
+	Edited    bool       `json:"edited,omitempty"`
+	Reactions []reaction `json:"reactions,omitempty"`
+	Replies   int        `json:"replies,omitempty"`
+	Thread    bool       `json:"thread,omitempty"`
+}
+
+// reaction is an emoji along with the number who reacted with it
+type reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+var (
+	chatEditedRe    = regexp.MustCompile(`\s*[\(\[]edited[\)\]]$`)
+	chatShortcodeRe = regexp.MustCompile(`:[a-z0-9_+\-]+:`)
+	chatMentionRe   = regexp.MustCompile(`(^|\s)@(\w)`)
+)
+
+// emoji for common shortcodes, others are left as the shortcode
+var emojiShortcodes = map[string]string{
+	":+1:":                     "👍",
+	":thumbsup:":               "👍",
+	":-1:":                     "👎",
+	":thumbsdown:":             "👎",
+	":smile:":                  "😄",
+	":slightly_smiling_face:":  "🙂",
+	":grin:":                   "😁",
+	":joy:":                    "😂",
+	":laughing:":               "😆",
+	":sweat_smile:":            "😅",
+	":wink:":                   "😉",
+	":thinking_face:":          "🤔",
+	":cry:":                    "😢",
+	":sob:":                    "😭",
+	":heart:":                  "❤️",
+	":fire:":                   "🔥",
+	":tada:":                   "🎉",
+	":eyes:":                   "👀",
+	":pray:":                   "🙏",
+	":clap:":                   "👏",
+	":wave:":                   "👋",
+	":ok_hand:":                "👌",
+	":raised_hands:":           "🙌",
+	":muscle:":                 "💪",
+	":rocket:":                 "🚀",
+	":100:":                    "💯",
+	":white_check_mark:":       "✅",
+	":heavy_check_mark:":       "✔️",
+	":x:":                      "❌",
+	":warning:":                "⚠️",
+	":bulb:":                   "💡",
+	":coffee:":                 "☕",
+	":sparkles:":               "✨",
+	":point_up:":               "☝️",
+	":see_no_evil:":            "🙈",
+	":upside_down_face:":       "🙃",
+	":face_with_rolling_eyes:": "🙄",
+}
+
+func expandEmoji(s string) string {
+	return chatShortcodeRe.ReplaceAllStringFunc(s, func(code string) string {
+		if e, found := emojiShortcodes[code]; found {
+			return e
+		}
+		return code
+	})
+}
+
+// transcript accumulates the messages of a chat as it's parsed
+type transcript struct {
+	msgs []chatMessage
+}
+
+// start begins a new message
+func (t *transcript) start(speaker, time, text string) *chatMessage {
+	t.msgs = append(t.msgs, chatMessage{Speaker: speaker, Time: time})
+	m := &t.msgs[len(t.msgs)-1]
+	if text != "" {
+		m.addText(text)
+	}
+	return m
+}
+
+// last is the message being parsed, or nil before the first message
+func (t *transcript) last() *chatMessage {
+	if len(t.msgs) == 0 {
+		return nil
+	}
+	return &t.msgs[len(t.msgs)-1]
+}
+
+// addText adds a line to the last message, or to a message without a
+// speaker before the first message
+func (t *transcript) addText(line string) {
+	m := t.last()
+	if m == nil {
+		m = t.start("", "", "")
+	}
+	m.addText(line)
+}
+
+// messages returns the messages, dropping those without text
+func (t *transcript) messages() []chatMessage {
+	var out []chatMessage
+	for _, msg := range t.msgs {
+		if msg.Text != "" {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// addText appends a line to the message, noting edits and removing the @
+// of mentions
+func (m *chatMessage) addText(line string) {
+	if chatEditedRe.MatchString(line) {
+		m.Edited = true
+		line = chatEditedRe.ReplaceAllString(line, "")
+	}
+	line = chatMentionRe.ReplaceAllString(line, "$1$2")
+	line = expandEmoji(line)
+	if m.Text != "" {
+		m.Text += "\n"
+	}
+	m.Text += line
+}
+
+// renderTranscript writes the messages as markdown, text or json,
+// consecutive messages of a speaker are grouped under one heading
+func renderTranscript(msgs []chatMessage, format string, timestamps bool) (string, error) {
+	if format == "json" {
+		bz, err := json.MarshalIndent(msgs, "", "  ")
+		return string(bz), err
+	}
+	if format != "markdown" && format != "text" {
+		return "", fmt.Errorf("unknown format %v, must be markdown, text or json", format)
+	}
+	md := format == "markdown"
+
+	var sb strings.Builder
+	for i, msg := range msgs {
+		newSpeaker := i == 0 || msgs[i-1].Speaker != msg.Speaker || msg.Thread
+		if newSpeaker {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			heading := msg.Speaker
+			if md && heading != "" {
+				heading = "**" + heading + "**"
+			}
+			if msg.Thread {
+				heading += " (in thread)"
+			}
+			if timestamps && msg.Time != "" {
+				heading += " " + msg.Time
+			}
+			if heading != "" {
+				sb.WriteString(strings.TrimSpace(heading) + "\n")
+			}
+		} else if timestamps && msg.Time != "" {
+			sb.WriteString(msg.Time + "\n")
+		}
+
+		text := msg.Text
+		if msg.Edited {
+			if md {
+				text += " _(edited)_"
+			} else {
+				text += " (edited)"
+			}
+		}
+		sb.WriteString(text + "\n")
+
+		var notes []string
+		if len(msg.Reactions) > 0 {
+			var rs []string
+			for _, r := range msg.Reactions {
+				rs = append(rs, fmt.Sprintf("%v %d", r.Emoji, r.Count))
+			}
+			notes = append(notes, strings.Join(rs, "  "))
+		}
+		if msg.Replies == 1 {
+			notes = append(notes, "1 reply")
+		} else if msg.Replies > 1 {
+			notes = append(notes, fmt.Sprintf("%d replies", msg.Replies))
+		}
+		if len(notes) > 0 {
+			note := strings.Join(notes, " · ")
+			if md {
+				note = "_" + note + "_"
+			}
+			sb.WriteString(note + "\n")
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+type chatCase struct {
+	name     string
+	in       string
+	names    []string
+	expected []chatMessage
+}
+
+func testChatParser(t *testing.T, parse chatParser, cases []chatCase) {
+	t.Helper()
+	for _, c := range cases {
+		msgs := parse(c.in, c.names)
+		if len(msgs) != len(c.expected) {
+			t.Errorf("%v: got %d messages, expected %d: %+v", c.name, len(msgs), len(c.expected), msgs)
+			continue
+		}
+		for i, m := range msgs {
+			if !reflect.DeepEqual(m, c.expected[i]) {
+				t.Errorf("%v: message %d: got %+v, expected %+v", c.name, i, m, c.expected[i])
+			}
+		}
+	}
+}
+
+func TestParseDiscord(t *testing.T) {
+	testChatParser(t, parseDiscord, []chatCase{
+		{"cozy", `Jane Doe — Today at 10:32 AM
+when should we meet?
+(edited)
+[10:34 AM]
+10:30
+Bob Smith — 10/12/2023 10:35 AM
+works for me`, nil, []chatMessage{
+			{Speaker: "Jane Doe", Time: "10:32 AM", Text: "when should we meet?", Edited: true},
+			{Speaker: "Jane Doe", Time: "10:34 AM", Text: "10:30"},
+			{Speaker: "Bob Smith", Time: "10:35 AM", Text: "works for me"},
+		}},
+		{"compact", `[10:32 AM] Jane Doe: when should we meet?
+[10:33 AM] Bob Smith: 10:30
+see you then`, nil, []chatMessage{
+			{Speaker: "Jane Doe", Time: "10:32 AM", Text: "when should we meet?"},
+			{Speaker: "Bob Smith", Time: "10:33 AM", Text: "10:30\nsee you then"},
+		}},
+		{"names", `jane
+when should we meet?`, []string{"jane"}, []chatMessage{
+			{Speaker: "jane", Text: "when should we meet?"},
+		}},
+	})
+}
+
+func TestParseMatrix(t *testing.T) {
+	testChatParser(t, parseMatrix, []chatCase{
+		{"export", `Thu, Oct 12 2023, 10:32 - @jane:matrix.org: when should we meet?
+Thu, Oct 12 2023, 10:33 - Bob Smith: 10:30
+works for me`, nil, []chatMessage{
+			{Speaker: "jane", Time: "10:32", Text: "when should we meet?"},
+			{Speaker: "Bob Smith", Time: "10:33", Text: "10:30\nworks for me"},
+		}},
+		{"timeline", `Jane Doe
+10:32
+when should we meet?
+Sounds good
+10:34
+Thanks
+10:35
+see you
+@bob:matrix.org
+10:36
+Reply
+works for me`, nil, []chatMessage{
+			{Speaker: "Jane Doe", Time: "10:32", Text: "when should we meet?\nSounds good"},
+			{Speaker: "Jane Doe", Time: "10:34", Text: "Thanks"},
+			{Speaker: "Jane Doe", Time: "10:35", Text: "see you"},
+			{Speaker: "bob", Time: "10:36", Text: "works for me"},
+		}},
+		{"names", `jane
+10:32
+when should we meet?`, []string{"jane"}, []chatMessage{
+			{Speaker: "jane", Time: "10:32", Text: "when should we meet?"},
+		}},
+	})
+}
+
+func TestParseTeams(t *testing.T) {
+	testChatParser(t, parseTeams, []chatCase{
+		{"bracketed", `[10/12/2023 10:32 AM] Jane Doe
+when should we meet?
+Edited
+👍 2
+[10/12/2023 10:33 AM] Bob Smith
+works for me`, nil, []chatMessage{
+			{Speaker: "Jane Doe", Time: "10:32 AM", Text: "when should we meet?", Edited: true,
+				Reactions: []reaction{{"👍", 2}}},
+			{Speaker: "Bob Smith", Time: "10:33 AM", Text: "works for me"},
+		}},
+		{"name then time", `Jane Doe
+10/12/2023 10:32 AM
+when should we meet?
+Sounds good
+10:30
+Like
+Bob Smith
+10:33 AM
+ok 2
+see you then`, nil, []chatMessage{
+			{Speaker: "Jane Doe", Time: "10:32 AM", Text: "when should we meet?\nSounds good\n10:30"},
+			{Speaker: "Bob Smith", Time: "10:33 AM", Text: "ok 2\nsee you then"},
+		}},
+		{"names", `jane
+10:32 AM
+when should we meet?`, []string{"jane"}, []chatMessage{
+			{Speaker: "jane", Time: "10:32 AM", Text: "when should we meet?"},
+		}},
+	})
+}
+
+func TestParseIRC(t *testing.T) {
+	testChatParser(t, parseIRC, []chatCase{
+		{"log", `[10:32] <jane> when should we meet?
+[10:33] <@bob> 10:30
+works for me
+-!- carol has joined #team
+[10:34] * bob waves
+10:35 <+carol> hi`, nil, []chatMessage{
+			{Speaker: "jane", Time: "10:32", Text: "when should we meet?"},
+			{Speaker: "bob", Time: "10:33", Text: "10:30\nworks for me"},
+			{Speaker: "bob", Time: "10:34", Text: "*bob waves*"},
+			{Speaker: "carol", Time: "10:35", Text: "hi"},
+		}},
+	})
+}
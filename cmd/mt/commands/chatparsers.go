@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parsers of chat formats other than slack (see slack.go)
+
+const chatTime = `\d{1,2}:\d{2}(?::\d{2})?(?:\s?[AaPp][Mm])?`
+
+// chatLines splits the text into trimmed lines
+func chatLines(text string) []string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+// chatSpeakerRe is the shape of a speaker's name on a line of its own, a
+// matrix id or two to four capitalized words, ex. "Jane Doe". Other names are
+// recognized when given, a single word is as likely to be a message.
+var chatSpeakerRe = regexp.MustCompile(`^(?:@[^:\s]+:\S+|\p{Lu}[\p{L}'.-]*(?: \p{Lu}[\p{L}'.-]*){1,3})$`)
+
+// isSpeakerLine reports whether the line, followed by a line of only the
+// time, is the name of the speaker
+func isSpeakerLine(line string, isName map[string]bool) bool {
+	return isName[line] || chatSpeakerRe.MatchString(line)
+}
+
+// nameLines returns the set of names which are speakers when found on a
+// line of their own
+func nameLines(names []string) map[string]bool {
+	isName := make(map[string]bool)
+	for _, name := range names {
+		isName[name] = true
+	}
+	return isName
+}
+
+var (
+	// ex. "Jane Doe — Today at 10:32 AM" or "Jane Doe — 10/12/2023 3:45 PM"
+	discordSpeakerRe = regexp.MustCompile(`^(\S.{0,60}?)\s+[—–-]\s+(?:(?:Today|Yesterday) at |[\d/.]+ )?(` + chatTime + `)$`)
+
+	// compact mode, ex. "[10:32 AM] Jane Doe: message"
+	discordCompactRe = regexp.MustCompile(`^\[(` + chatTime + `)\]\s*([^:]{1,60}):\s*(.*)$`)
+
+	// continuation messages of the previous speaker, ex. "[10:34 AM]"
+	discordContinuedRe = regexp.MustCompile(`^\[(` + chatTime + `)\]$`)
+)
+
+// parseDiscord parses text copied from discord in cozy or compact mode
+func parseDiscord(text string, names []string) []chatMessage {
+	isName := nameLines(names)
+	var t transcript
+	speaker := ""
+	for _, line := range chatLines(text) {
+		switch {
+		case line == "":
+			continue
+		case line == "(edited)" || line == "[edited]":
+			if cur := t.last(); cur != nil {
+				cur.Edited = true
+			}
+		case isName[line]:
+			speaker = line
+			t.start(speaker, "", "")
+		case discordSpeakerRe.MatchString(line):
+			m := discordSpeakerRe.FindStringSubmatch(line)
+			speaker = m[1]
+			t.start(speaker, m[2], "")
+		case discordCompactRe.MatchString(line):
+			m := discordCompactRe.FindStringSubmatch(line)
+			speaker = m[2]
+			t.start(speaker, m[1], m[3])
+		case discordContinuedRe.MatchString(line):
+			t.start(speaker, discordContinuedRe.FindStringSubmatch(line)[1], "")
+		default:
+			t.addText(line)
+		}
+	}
+	return t.messages()
+}
+
+var (
+	// element's plain text export, ex.
+	// "Thu, Oct 12 2023, 10:32 - @jane:matrix.org: message"
+	matrixExportRe = regexp.MustCompile(`^(?:\w{3}, \w{3} \d{1,2} \d{4}, )?(` + chatTime + `) - ([^:\s]+(?::[^:\s]+)?|[^:]{1,60}): (.*)$`)
+
+	// copied from the timeline, a time on its own line after the speaker
+	matrixTimeRe = regexp.MustCompile(`^(` + chatTime + `)$`)
+
+	// matrix ids are shortened to their local part, ex. "@jane:matrix.org"
+	matrixIDRe = regexp.MustCompile(`^@([^:\s]+):\S+$`)
+
+	// lines of the element interface rather than of messages
+	matrixNoiseRe = regexp.MustCompile(`^(?:Today|Yesterday|Reply|React|Options|Edit|` +
+		`.+ (?:joined the room|left the room|changed their (?:display name|profile picture).*))$`)
+)
+
+func matrixName(name string) string {
+	if m := matrixIDRe.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return name
+}
+
+// parseMatrix parses element's plain text export or text copied from its
+// timeline, where a line of only a time follows the speaker's name
+func parseMatrix(text string, names []string) []chatMessage {
+	isName := nameLines(names)
+	var t transcript
+	speaker := ""
+	lines := chatLines(text)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case line == "" || matrixNoiseRe.MatchString(line):
+			continue
+		case line == "(edited)":
+			if cur := t.last(); cur != nil {
+				cur.Edited = true
+			}
+		case matrixExportRe.MatchString(line):
+			m := matrixExportRe.FindStringSubmatch(line)
+			speaker = matrixName(m[2])
+			t.start(speaker, m[1], m[3])
+		case i+1 < len(lines) && matrixTimeRe.MatchString(lines[i+1]) && isSpeakerLine(line, isName):
+			speaker = matrixName(line)
+			t.start(speaker, lines[i+1], "")
+			i++
+		case isName[line]:
+			speaker = line
+			t.start(speaker, "", "")
+		case matrixTimeRe.MatchString(line):
+			t.start(speaker, line, "")
+		default:
+			t.addText(line)
+		}
+	}
+	return t.messages()
+}
+
+var (
+	// ex. "[10/12/2023 10:32 AM] Jane Doe", otherwise the name is followed
+	// by a line of only the time
+	teamsSpeakerRe = regexp.MustCompile(`^\[(?:[\d/.]+ )?(` + chatTime + `)\]\s+(\S.{0,60})$`)
+	teamsTimeRe    = regexp.MustCompile(`^(?:[\d/.]+ )?(` + chatTime + `)$`)
+
+	// reactions are copied as the emoji and the count, ex. "👍 2"
+	teamsReactionRe = regexp.MustCompile(`^(\S{1,8}) (\d+)$`)
+
+	// lines of the teams interface rather than of messages
+	teamsNoiseRe = regexp.MustCompile(`^(?:has context menu|Like|Reply|Collapse all|See more|` +
+		`\d+ repl(?:y|ies)(?: from .*)?|.+ (?:joined|left) the (?:chat|meeting|team))$`)
+)
+
+// parseTeams parses text copied from microsoft teams
+func parseTeams(text string, names []string) []chatMessage {
+	isName := nameLines(names)
+	var t transcript
+	lines := chatLines(text)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		cur := t.last()
+		switch {
+		case line == "" || teamsNoiseRe.MatchString(line):
+			continue
+		case line == "Edited" || line == "(edited)":
+			if cur != nil {
+				cur.Edited = true
+			}
+		case teamsSpeakerRe.MatchString(line):
+			m := teamsSpeakerRe.FindStringSubmatch(line)
+			t.start(m[2], m[1], "")
+		case i+1 < len(lines) && teamsTimeRe.MatchString(lines[i+1]) && isSpeakerLine(line, isName):
+			t.start(line, teamsTimeRe.FindStringSubmatch(lines[i+1])[1], "")
+			i++
+		case isName[line]:
+			t.start(line, "", "")
+		case teamsReactionRe.MatchString(line) && cur != nil && !isWordy(line):
+			m := teamsReactionRe.FindStringSubmatch(line)
+			count, _ := strconv.Atoi(m[2])
+			cur.Reactions = append(cur.Reactions, reaction{expandEmoji(m[1]), count})
+		default:
+			t.addText(line)
+		}
+	}
+	return t.messages()
+}
+
+// isWordy is true when the text contains letters or digits before its
+// last space, distinguishing "ok 2" from a reaction
+func isWordy(line string) bool {
+	first := line[:strings.LastIndex(line, " ")]
+	for _, r := range first {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ex. "[10:32] <jane> message" or "10:32 <@jane> message"
+	ircMessageRe = regexp.MustCompile(`^(?:\[?(` + chatTime + `)\]?\s+)?<[@+%~&]?([^>\s]+)>\s?(.*)$`)
+
+	// actions, ex. "[10:32] * jane waves"
+	ircActionRe = regexp.MustCompile(`^(?:\[?(` + chatTime + `)\]?\s+)?\*\s+([^\s*]+)\s+(.*)$`)
+
+	// joins, parts, quits, mode and topic changes
+	ircNoiseRe = regexp.MustCompile(`^(?:\[?` + chatTime + `\]?\s+)?(?:-!-|\*\*\*|-->|<--|--)\s`)
+)
+
+// parseIRC parses irc logs as written by most clients, lines without a
+// speaker continue the previous message
+func parseIRC(text string, names []string) []chatMessage {
+	var t transcript
+	for _, line := range chatLines(text) {
+		switch {
+		case line == "" || ircNoiseRe.MatchString(line):
+			continue
+		case ircMessageRe.MatchString(line):
+			m := ircMessageRe.FindStringSubmatch(line)
+			t.start(m[2], m[1], m[3])
+		case ircActionRe.MatchString(line):
+			m := ircActionRe.FindStringSubmatch(line)
+			t.start(m[2], m[1], "*"+m[2]+" "+m[3]+"*")
+		default:
+			t.addText(line)
+		}
+	}
+	return t.messages()
+}
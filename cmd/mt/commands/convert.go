@@ -3,6 +3,7 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -21,11 +22,16 @@ var (
 	}
 )
 
-var decimalPlacesFromFlag int
+var (
+	decimalPlacesFromFlag int
+	explainFromFlag       bool
+)
 
 func init() {
 	ConvertCmd.PersistentFlags().IntVarP(&decimalPlacesFromFlag, "decimals", "d", -1,
 		"number of decimal places (-1 for auto)")
+	ConvertCmd.PersistentFlags().BoolVar(&explainFromFlag, "explain", false,
+		"print the chain of units and factors used")
 	RootCmd.AddCommand(ConvertCmd)
 }
 
@@ -50,140 +56,233 @@ var (
 		"lemons":        "lemon",
 		"baking-soda":   "bakingsoda",
 		"baking-powder": "bakingpowder",
+		"h":             "hr",
+		"hour":          "hr",
+		"sec":           "s",
+		"lb":            "pound",
+		"lbs":           "pound",
+		"tonne":         "t",
+	}
+
+	// equivalences between things which are not physical units, the
+	// inverse of each equivalence is derived automatically
+	equivalences = []equivalence{
+		{"lemon", "tablespoon", 4, 5},
+		{"lemon", "cup", 1.0 / 4, 1.0 / 3},
+		{"cup", "egg", 5, 5},
+		{"bakingsoda", "bakingpowder", 4, 4},
 	}
 
-	// TODO add with reverse function for standard multiplier conversions
-	cvs = map[string]string{ // map[from_to]expr
-		"C_F":                     "(a*1.8)+32",
-		"F_C":                     "(a-32)/1.8",
-		"g_ml_water":              "a",
-		"g_L_water":               "a/1000",
-		"acre_hectare":            "a*0.404686",
-		"hectare_acre":            "a/0.404686",
-		"acre_ft^2":               "a*43560.04",
-		"ft^2_acre":               "a/43560.04",
-		"hectare_sqft":            "a*107639.1",
-		"ft^2_hectare":            "a/107639.1",
-		"m_ft":                    "a*3.28084",
-		"km_mi":                   "a*0.6213712",
-		"mi_km":                   "a/0.6213712",
-		"m_km":                    "a/1000",
-		"km_m":                    "a*1000",
-		"m_cm":                    "a*100",
-		"cm_m":                    "a/100",
-		"m_mm":                    "a*1000",
-		"mm_m":                    "a/1000",
-		"ft_m":                    "a/3.28084",
-		"ft_in":                   "a*12",
-		"in_ft":                   "a/12",
-		"in_mm":                   "a*25.4",
-		"mm_in":                   "a/25.4",
-		"m^2_ft^2":                "a*10.76390999",
-		"ft^2_m^2":                "a/10.76390999",
-		"ft^2_L":                  "a*28.31685",
-		"L_ft^2":                  "a/28.31685",
-		"pint_cup":                "a*2",
-		"cup_pint":                "a/2",
-		"quart_cup":               "a*4",
-		"cup_quart":               "a/4",
-		"cup_L":                   "a*0.236587524",
-		"L_cup":                   "a/0.236587524",
-		"gal_L":                   "a*4.54609",
-		"L_gal":                   "a/4.54609",
-		"L_mL":                    "a*1000",
-		"mL_L":                    "a/1000",
-		"tablespoon_teaspoon":     "a*3",
-		"teaspoon_tablespoon":     "a/3",
-		"tablespoon_cup":          "a*0.0625",
-		"cup_tablespoon":          "a/0.0625",
-		"teaspoon_cup":            "a*0.02083333156038129",
-		"cup_teaspoon":            "a/0.02083333156038129",
-		"kg_pound":                "a*2.204623",
-		"pound_kg":                "a/2.204623",
-		"lemon_tablespoon":        "RANGE a*4 a*5",
-		"tablespoon_lemon":        "RANGE a/4 a/5",
-		"lemon_cup":               "RANGE a*1/4 a*1/3",
-		"cup_lemon":               "RANGE a/(1/4) a/(1/3)",
-		"cup_egg":                 "a*5",
-		"egg_cup":                 "a/5",
-		"bakingsoda_bakingpowder": "a*4",
-		"bakingpowder_bakingsoda": "a/4",
+	// material densities used to convert between mass and volume
+	densities = map[string]float64{ // map[material]density in g/mL
+		"water": 1,
 	}
 )
 
-func getAllConversionsFrom(from string) (tos map[string]struct{}) {
-	tos = make(map[string]struct{})
-	for i, _ := range cvs {
-		split := strings.SplitN(i, "_", 2)
-		if len(split) != 2 {
-			panic(fmt.Sprintf("bad split: %v; %v", split, i))
+// equivalence defines one "from" as being between low and high of "to"
+type equivalence struct {
+	from, to  string
+	low, high float64
+}
+
+func (e equivalence) inverse() equivalence {
+	return equivalence{e.to, e.from, 1 / e.high, 1 / e.low}
+}
+
+// getEquivalences returns all equivalences (including inverses) from a unit
+func getEquivalences(from string) (eqs []equivalence) {
+	if u, found := unitAlias[from]; found {
+		from = u
+	}
+	for _, eq := range equivalences {
+		if eq.from == from {
+			eqs = append(eqs, eq)
 		}
-		fromSplit, toSplit := split[0], split[1]
-		if fromSplit == from {
-			tos[toSplit] = struct{}{}
+		if eq.to == from {
+			eqs = append(eqs, eq.inverse())
 		}
 	}
-	return tos
+	return eqs
 }
 
-func getAllConversionsTo(to string) (froms map[string]struct{}) {
-	froms = make(map[string]struct{})
-	for i, _ := range cvs {
-		split := strings.SplitN(i, "_", 2)
-		if len(split) != 2 {
-			panic(fmt.Sprintf("bad split: %v; %v", split, i))
-		}
-		fromSplit, toSplit := split[0], split[1]
-		if toSplit == to {
-			froms[fromSplit] = struct{}{}
+func isEquivalenceUnit(name string) bool {
+	return len(getEquivalences(name)) > 0
+}
+
+// linearFactorBetween returns the multiplier between two registered units,
+// returning false if either is unregistered, dimensions differ or the
+// conversion has an offset
+func linearFactorBetween(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	fromU, okF := lookupUnit(from)
+	toU, okT := lookupUnit(to)
+	if !okF || !okT || fromU.dim != toU.dim || fromU.offset != 0 || toU.offset != 0 {
+		return 0, false
+	}
+	return fromU.factor / toU.factor, true
+}
+
+// conversionStep is a single hop within a conversion path, the converted
+// amount is between a*low+offset and a*high+offset
+type conversionStep struct {
+	from, to  string
+	low, high float64
+	offset    float64
+	source    string // what provides the step, ex. "units" or "equivalence"
+}
+
+func (s conversionStep) String() string {
+	sigFigs := func(f float64) string { return strconv.FormatFloat(f, 'g', 10, 64) }
+	factor := "x" + sigFigs(s.low)
+	if s.low != s.high {
+		factor += " to x" + sigFigs(s.high)
+	}
+	if s.offset > 0 {
+		factor += " + " + sigFigs(s.offset)
+	} else if s.offset < 0 {
+		factor += " - " + sigFigs(-s.offset)
+	}
+	return fmt.Sprintf("%v -> %v: %v (%v)", s.from, s.to, factor, s.source)
+}
+
+// composeSteps combines the steps of a path into a single step
+func composeSteps(steps []conversionStep) conversionStep {
+	out := conversionStep{low: 1, high: 1}
+	for i, s := range steps {
+		if i == 0 {
+			out.from = s.from
 		}
+		out.to = s.to
+		out.low *= s.low
+		out.high *= s.high
+		out.offset = out.offset*s.low + s.offset
 	}
-	return froms
+	return out
 }
 
-func getConversionExpression(from, to, of string) (exprStr string, err error) {
+// apply converts the interval of amounts
+func (s conversionStep) apply(amount interval) interval {
+	return amount.mul(interval{s.low, s.high}).add(exact(s.offset))
+}
 
-	lookup := from + "_" + to
+// directStep returns the step between two units which doesn't require an
+// equivalence, either as both are of the same dimension or through the
+// density of a material
+func directStep(from, to, of string) (conversionStep, bool) {
+	fromU, okF := lookupUnit(from)
+	toU, okT := lookupUnit(to)
+	if !okF || !okT {
+		return conversionStep{}, false
+	}
+	if fromU.dim == toU.dim {
+		factor := fromU.factor / toU.factor
+		offset := (fromU.offset - toU.offset) / toU.factor
+		return conversionStep{from, to, factor, factor, offset, "units"}, true
+	}
+	if of == "" {
+		return conversionStep{}, false
+	}
+	density, found := densities[strings.ToLower(of)]
+	if !found {
+		return conversionStep{}, false
+	}
+	densitySI := density * 1000 // g/mL -> kg/m^3
+	source := fmt.Sprintf("density of %v, %v g/mL", of, formatFactor(density))
+	switch {
+	case fromU.dim == dimWeight && toU.dim == dimVolume:
+		factor := fromU.factor / densitySI / toU.factor
+		return conversionStep{from, to, factor, factor, 0, source}, true
+	case fromU.dim == dimVolume && toU.dim == dimWeight:
+		factor := fromU.factor * densitySI / toU.factor
+		return conversionStep{from, to, factor, factor, 0, source}, true
+	}
+	return conversionStep{}, false
+}
+
+// getConversionPath finds the shortest chain of steps from one unit to
+// another. The graph searched is made of the two units and every unit with
+// an equivalence, connected by equivalences, by shared dimensions, and by the
+// density of the material if provided.
+func getConversionPath(from, to, of string) ([]conversionStep, error) {
+	fromName, okF := knownUnit(from)
+	if !okF {
+		return nil, unknownUnitError(from)
+	}
+	toName, okT := knownUnit(to)
+	if !okT {
+		return nil, unknownUnitError(to)
+	}
 	if of != "" {
-		lookup += "_" + of
+		if _, found := densities[strings.ToLower(of)]; !found {
+			return nil, fmt.Errorf("unknown material %v", of)
+		}
+	}
+	if fromName == toName {
+		return []conversionStep{{fromName, toName, 1, 1, 0, "units"}}, nil
 	}
-	convExpr, found := cvs[lookup]
-	if !found && of == "" {
 
-		// look for an intermediary
-		froms := getAllConversionsTo(to)
-		tos := getAllConversionsFrom(from)
+	nodeSet := map[string]struct{}{fromName: {}, toName: {}}
+	for _, eq := range equivalences {
+		nodeSet[eq.from] = struct{}{}
+		nodeSet[eq.to] = struct{}{}
+	}
+	var nodes []string
+	for node := range nodeSet {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
 
-		commonUnit := ""
-		for fromCom, _ := range froms {
-			_, foundT := tos[fromCom]
-			if foundT {
-				commonUnit = fromCom
-				break
-			}
+	edges := func(u string) (steps []conversionStep) {
+		for _, eq := range getEquivalences(u) {
+			steps = append(steps, conversionStep{eq.from, eq.to, eq.low, eq.high, 0, "equivalence"})
 		}
-		if commonUnit == "" {
-			return "", errors.New("unknown conversion")
+		for _, v := range nodes {
+			if v == u {
+				continue
+			}
+			if step, ok := directStep(u, v, of); ok {
+				steps = append(steps, step)
+			}
 		}
+		return steps
+	}
 
-		lookupCommon1 := from + "_" + commonUnit
-		lookupCommon2 := commonUnit + "_" + to
-		convExprCommon1, found1 := cvs[lookupCommon1]
-		if !found1 {
-			panic(fmt.Sprintf("couldn't lookup %v", lookupCommon1))
+	// breadth first search for the path with the fewest steps
+	prev := map[string]conversionStep{}
+	visited := map[string]bool{fromName: true}
+	queue := []string{fromName}
+	for len(queue) > 0 && !visited[toName] {
+		u := queue[0]
+		queue = queue[1:]
+		for _, step := range edges(u) {
+			if visited[step.to] {
+				continue
+			}
+			visited[step.to] = true
+			prev[step.to] = step
+			queue = append(queue, step.to)
 		}
-		convExprCommon2, found2 := cvs[lookupCommon2]
-		if !found2 {
-			panic(fmt.Sprintf("couldn't lookup %v", lookupCommon2))
+	}
+	if !visited[toName] {
+		fromU, okF := lookupUnit(fromName)
+		toU, okT := lookupUnit(toName)
+		if okF && okT {
+			if of == "" && ((fromU.dim == dimWeight && toU.dim == dimVolume) ||
+				(fromU.dim == dimVolume && toU.dim == dimWeight)) {
+				return nil, fmt.Errorf("converting %v to %v requires a material (of <material>)", from, to)
+			}
+			return nil, fmt.Errorf("cannot convert %v (%v) to %v (%v)", from, fromU.dim, to, toU.dim)
 		}
-		convExpr = strings.Replace(convExprCommon2, "a", convExprCommon1, 1)
-		return convExpr, nil
+		return nil, errors.New("unknown conversion")
 	}
-	// if still not found error out
-	if !found {
-		return "", errors.New("unknown conversion")
+
+	var path []conversionStep
+	for node := toName; node != fromName; node = prev[node].from {
+		path = append([]conversionStep{prev[node]}, path...)
 	}
-	return convExpr, nil
+	return path, nil
 }
 
 func convertCmd(_ *cobra.Command, args []string) error {
@@ -192,6 +291,9 @@ func convertCmd(_ *cobra.Command, args []string) error {
 	if toArg != "to" {
 		return errors.New("the word \"to\" not in the correct place (3rd arg)")
 	}
+	if isTZ, err := convertTimeZone(args); isTZ {
+		return err
+	}
 	if len(args) == 5 {
 		return errors.New("invalid number of args")
 	}
@@ -210,13 +312,24 @@ func convertCmd(_ *cobra.Command, args []string) error {
 		decimalPlaces = decimalPlacesFromFlag
 	}
 
-	// the input amount can be an expression itself
-	amountExpr, err := govaluate.NewEvaluableExpression(amountStr)
-	if err != nil {
-		return err
+	// the input amount can be an expression itself, or a range of two
+	// expressions separated by "..", ex. 2..3
+	var amount interval
+	for i, amountStr := range strings.SplitN(amountStr, "..", 2) {
+		amountExpr, err := govaluate.NewEvaluableExpression(amountStr)
+		if err != nil {
+			return err
+		}
+		amountI, err := amountExpr.Evaluate(nil)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			amount = exact(amountI.(float64))
+		} else {
+			amount = bounds(amount.lo, amountI.(float64))
+		}
 	}
-	amountI, err := amountExpr.Evaluate(nil)
-	amount := amountI.(float64)
 
 	uf, ok := unitAlias[unitFrom]
 	if ok {
@@ -228,58 +341,22 @@ func convertCmd(_ *cobra.Command, args []string) error {
 		unitTo = ut
 	}
 
-	convExpr, err := getConversionExpression(unitFrom, unitTo, material)
+	path, err := getConversionPath(unitFrom, unitTo, material)
 	if err != nil {
 		return err
 	}
-
-	if strings.HasPrefix(convExpr, "RANGE") {
-		splt := strings.Fields(convExpr)
-		if len(splt) != 3 {
-			panic(fmt.Sprintf("invalid range expression input: %v", convExpr))
-		}
-		convExpr1 := splt[1]
-		convExpr2 := splt[2]
-
-		expr1, err := govaluate.NewEvaluableExpression(convExpr1)
-		if err != nil {
-			return err
-		}
-		expr2, err := govaluate.NewEvaluableExpression(convExpr2)
-		if err != nil {
-			return err
-		}
-		param := map[string]interface{}{"a": amount}
-		convertedAmt1, err := expr1.Evaluate(param)
-		if err != nil {
-			return err
-		}
-		convertedAmt2, err := expr2.Evaluate(param)
-		if err != nil {
-			return err
-		}
-
-		f1 := strconv.FormatFloat(convertedAmt1.(float64), 'f', decimalPlaces, 64)
-		f2 := strconv.FormatFloat(convertedAmt2.(float64), 'f', decimalPlaces, 64)
-		if f1 < f2 {
-			fmt.Printf("between %v - %v %v\n", f1, f2, unitTo)
-		} else {
-			fmt.Printf("between %v - %v %v\n", f2, f1, unitTo)
+	if explainFromFlag {
+		for _, step := range path {
+			fmt.Println(step)
 		}
-	} else {
-		expr, err := govaluate.NewEvaluableExpression(convExpr)
-		if err != nil {
-			return err
-		}
-
-		param := map[string]interface{}{"a": amount}
-		convertedAmt, err := expr.Evaluate(param)
-		if err != nil {
-			return err
-		}
-
-		f := strconv.FormatFloat(convertedAmt.(float64), 'f', decimalPlaces, 64)
-		fmt.Printf("%v %v\n", f, unitTo)
+	}
+	converted := composeSteps(path).apply(amount)
+	formatAmount := func(amount float64) string {
+		return strconv.FormatFloat(amount, 'f', decimalPlaces, 64)
+	}
+	fmt.Printf("%v %v\n", converted.format(formatAmount), unitTo)
+	if note := pathRatesNote(path); note != "" {
+		fmt.Println(note)
 	}
 	return nil
 }
@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLemonConversions(t *testing.T) {
+	cases := []struct {
+		from, to  string
+		low, high float64
+	}{
+		{"lemon", "tablespoon", 4, 5},
+		{"lemon", "cup", 1.0 / 4, 1.0 / 3},
+		{"cup", "lemon", 3, 4},
+	}
+	for _, c := range cases {
+		path, err := getConversionPath(c.from, c.to, "")
+		if err != nil {
+			t.Errorf("%v to %v: %v", c.from, c.to, err)
+			continue
+		}
+		step := composeSteps(path)
+		if math.Abs(step.low-c.low) > 1e-9 || math.Abs(step.high-c.high) > 1e-9 {
+			t.Errorf("%v to %v: got %v to %v, expected %v to %v", c.from, c.to, step.low, step.high, c.low, c.high)
+		}
+	}
+}
@@ -1,20 +1,28 @@
 package commands
 
 import (
-	"bufio"
+	"encoding/csv"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/knetic/govaluate"
 	"github.com/rigelrozanski/common"
 	"github.com/spf13/cobra"
 )
 
-// Lock2yamlCmd represents the lock2yaml command
+// CSVCmd represents the csv command group, each of the commands stream from
+// a file or stdin to stdout so they may be composed within a pipeline, the
+// first row of the input is its header
 var (
 	CSVCmd = &cobra.Command{
-		Use:   "csv",
-		Short: "csv processing commands",
+		Use:               "csv",
+		Short:             "csv processing commands",
+		PersistentPreRunE: parseDelimiter,
 	}
 	LastColOnlyCmd = &cobra.Command{
 		Use:   "last-col-only [read-file] [write-file]",
@@ -22,10 +30,71 @@ var (
 		Args:  cobra.ExactArgs(2),
 		RunE:  lastColOnlyCmd,
 	}
+	CSVSelectCmd = &cobra.Command{
+		Use:   "select [columns] [file]",
+		Short: "select and reorder columns by name or index from 1, ex. \"name,3,email\"",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  csvSelectCmd,
+	}
+	CSVFilterCmd = &cobra.Command{
+		Use:   "filter [expr] [file]",
+		Short: "keep rows where the expression is true, ex. \"price > 10 && [first name] == 'ann'\"",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  csvFilterCmd,
+	}
+	CSVSortCmd = &cobra.Command{
+		Use:   "sort [columns] [file]",
+		Short: "sort rows by the columns, numerically when both values are numbers",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  csvSortCmd,
+	}
+	CSVDedupeCmd = &cobra.Command{
+		Use:   "dedupe [file]",
+		Short: "remove duplicate rows, keeping the first",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvDedupeCmd,
+	}
+	CSVJoinCmd = &cobra.Command{
+		Use:   "join [key] [left-file] [right-file]",
+		Short: "join the rows of two files with the same key, ex. \"id\" or \"id=user_id\"",
+		Args:  cobra.ExactArgs(3),
+		RunE:  csvJoinCmd,
+	}
+	CSVGroupCmd = &cobra.Command{
+		Use:   "group [columns] [file]",
+		Short: "group rows by the columns and aggregate, ex. --agg \"count,sum:price,mean:qty\"",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  csvGroupCmd,
+	}
+)
+
+var (
+	delimFromFlag    string
+	descFromFlag     bool
+	dedupeFromFlag   string
+	leftJoinFromFlag bool
+	aggFromFlag      string
 )
 
 func init() {
+	CSVCmd.PersistentFlags().StringVar(&delimFromFlag, "delim", ",",
+		"field delimiter, ex. \";\" or \"tab\"")
+	CSVSortCmd.PersistentFlags().BoolVarP(&descFromFlag, "desc", "r", false,
+		"sort in descending order")
+	CSVDedupeCmd.PersistentFlags().StringVar(&dedupeFromFlag, "cols", "",
+		"only compare these columns for duplicates")
+	CSVJoinCmd.PersistentFlags().BoolVar(&leftJoinFromFlag, "left", false,
+		"keep rows of the left file without a match")
+	CSVGroupCmd.PersistentFlags().StringVar(&aggFromFlag, "agg", "count",
+		"aggregates as function:column, functions are count, sum, mean, min, max")
+
 	CSVCmd.AddCommand(LastColOnlyCmd)
+	CSVCmd.AddCommand(CSVSelectCmd)
+	CSVCmd.AddCommand(CSVFilterCmd)
+	CSVCmd.AddCommand(CSVSortCmd)
+	CSVCmd.AddCommand(CSVDedupeCmd)
+	CSVCmd.AddCommand(CSVJoinCmd)
+	CSVCmd.AddCommand(CSVGroupCmd)
 	RootCmd.AddCommand(CSVCmd)
 }
 
@@ -39,14 +108,13 @@ func lastColOnlyCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		split := strings.Split(line, ",")
-		last := split[len(split)-1]
-		writeLines = append(writeLines, last)
-	}
-	if err := scanner.Err(); err != nil {
+	err = forEachCSVRecord(newCSVReader(file), func(record []string) error {
+		if len(record) > 0 {
+			writeLines = append(writeLines, record[len(record)-1])
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 	if err := common.WriteLines(writeLines, newFilePath); err != nil {
@@ -56,3 +124,469 @@ func lastColOnlyCmd(cmd *cobra.Command, args []string) error {
 	fmt.Println("completed")
 	return nil
 }
+
+// openCSVFile opens the file for reading, an empty path or "-" reads stdin
+func openCSVFile(path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// csvColumnIndex finds a column by its header name, or otherwise by its
+// index counting from 1
+func csvColumnIndex(header []string, col string) (int, error) {
+	for i, name := range header {
+		if strings.TrimSpace(name) == col {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(col); err == nil {
+		if i < 1 || i > len(header) {
+			return 0, fmt.Errorf("column %v out of range, there are %d columns", i, len(header))
+		}
+		return i - 1, nil
+	}
+	return 0, fmt.Errorf("no column named %v", col)
+}
+
+// csvColumnIndexes finds each of the comma separated columns
+func csvColumnIndexes(header []string, cols string) ([]int, error) {
+	var idxs []int
+	for _, col := range strings.Split(cols, ",") {
+		i, err := csvColumnIndex(header, strings.TrimSpace(col))
+		if err != nil {
+			return nil, err
+		}
+		idxs = append(idxs, i)
+	}
+	return idxs, nil
+}
+
+// csvComma is the field delimiter set by --delim
+var csvComma = ','
+
+func parseDelimiter(cmd *cobra.Command, args []string) error {
+	switch delimFromFlag {
+	case "tab", "\\t", "\t":
+		csvComma = '\t'
+		return nil
+	}
+	rs := []rune(delimFromFlag)
+	if len(rs) != 1 || rs[0] == '"' || rs[0] == '\n' || rs[0] == '\r' {
+		return fmt.Errorf("bad delimiter %q, must be a single character", delimFromFlag)
+	}
+	csvComma = rs[0]
+	return nil
+}
+
+// newCSVReader reads RFC 4180 csv, allowing rows to vary in length
+func newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = csvComma
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+func newCSVWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = csvComma
+	return writer
+}
+
+// forEachCSVRecord calls fn for each of the remaining records
+func forEachCSVRecord(r *csv.Reader, fn func(record []string) error) error {
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// csvField returns the field of the record, or empty if the record is short
+func csvField(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+func csvFields(record []string, idxs []int) []string {
+	out := make([]string, len(idxs))
+	for j, i := range idxs {
+		out[j] = csvField(record, i)
+	}
+	return out
+}
+
+// csvStream opens the input (the optional file argument or stdin), reads its
+// header and passes the reader for the remaining records along with a
+// writer to stdout which is flushed once fn returns
+func csvStream(args []string, fileArg int,
+	fn func(header []string, r *csv.Reader, w *csv.Writer) error) error {
+
+	path := ""
+	if len(args) > fileArg {
+		path = args[fileArg]
+	}
+	in, err := openCSVFile(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r := newCSVReader(in)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w := newCSVWriter(os.Stdout)
+	if err := fn(header, r, w); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func csvSelectCmd(cmd *cobra.Command, args []string) error {
+	return csvStream(args, 1, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		idxs, err := csvColumnIndexes(header, args[0])
+		if err != nil {
+			return err
+		}
+		if err := w.Write(csvFields(header, idxs)); err != nil {
+			return err
+		}
+		return forEachCSVRecord(r, func(record []string) error {
+			return w.Write(csvFields(record, idxs))
+		})
+	})
+}
+
+// csvParam is a field as an expression parameter, numbers are compared as
+// numbers and everything else as strings
+func csvParam(field string) interface{} {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+		return v
+	}
+	return field
+}
+
+func csvFilterCmd(cmd *cobra.Command, args []string) error {
+	expr, err := govaluate.NewEvaluableExpression(args[0])
+	if err != nil {
+		return err
+	}
+	return csvStream(args, 1, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		row := 1
+		return forEachCSVRecord(r, func(record []string) error {
+			row++
+			params := make(map[string]interface{}, len(header))
+			for i, name := range header {
+				params[strings.TrimSpace(name)] = csvParam(csvField(record, i))
+			}
+			res, err := expr.Evaluate(params)
+			if err != nil {
+				return fmt.Errorf("row %d: %v", row, err)
+			}
+			keep, ok := res.(bool)
+			if !ok {
+				return fmt.Errorf("filter must be true or false, got %v", res)
+			}
+			if !keep {
+				return nil
+			}
+			return w.Write(record)
+		})
+	})
+}
+
+// compareCSVFields compares numerically when both fields are numbers
+func compareCSVFields(a, b string) int {
+	x, errX := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errY := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	switch {
+	case errX == nil && errY == nil && x < y:
+		return -1
+	case errX == nil && errY == nil && x > y:
+		return 1
+	case errX == nil && errY == nil:
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func csvSortCmd(cmd *cobra.Command, args []string) error {
+	return csvStream(args, 1, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		idxs, err := csvColumnIndexes(header, args[0])
+		if err != nil {
+			return err
+		}
+		records, err := r.ReadAll()
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			for _, idx := range idxs {
+				c := compareCSVFields(csvField(records[i], idx), csvField(records[j], idx))
+				if c != 0 {
+					return (c < 0) != descFromFlag
+				}
+			}
+			return false
+		})
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		return w.WriteAll(records)
+	})
+}
+
+// csvKey joins fields into a single map key
+func csvKey(fields []string) string {
+	return strings.Join(fields, "\x00")
+}
+
+func csvDedupeCmd(cmd *cobra.Command, args []string) error {
+	return csvStream(args, 0, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		var idxs []int
+		if dedupeFromFlag != "" {
+			var err error
+			idxs, err = csvColumnIndexes(header, dedupeFromFlag)
+			if err != nil {
+				return err
+			}
+		}
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		return forEachCSVRecord(r, func(record []string) error {
+			key := csvKey(record)
+			if idxs != nil {
+				key = csvKey(csvFields(record, idxs))
+			}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+			return w.Write(record)
+		})
+	})
+}
+
+// csvJoinCmd reads the right file into memory and streams the left file,
+// writing the left row followed by the right row (without its key) for
+// each match
+func csvJoinCmd(cmd *cobra.Command, args []string) error {
+	leftKey, rightKey := args[0], args[0]
+	if split := strings.SplitN(args[0], "=", 2); len(split) == 2 {
+		leftKey, rightKey = split[0], split[1]
+	}
+
+	rightFile, err := os.Open(args[2])
+	if err != nil {
+		return err
+	}
+	defer rightFile.Close()
+	rr := newCSVReader(rightFile)
+	rightHeader, err := rr.Read()
+	if err != nil {
+		return fmt.Errorf("reading %v: %v", args[2], err)
+	}
+	ri, err := csvColumnIndex(rightHeader, rightKey)
+	if err != nil {
+		return fmt.Errorf("%v: %v", args[2], err)
+	}
+	var rightCols []int
+	for i := range rightHeader {
+		if i != ri {
+			rightCols = append(rightCols, i)
+		}
+	}
+	rightRows := make(map[string][][]string)
+	err = forEachCSVRecord(rr, func(record []string) error {
+		key := csvField(record, ri)
+		rightRows[key] = append(rightRows[key], csvFields(record, rightCols))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return csvStream(args, 1, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		li, err := csvColumnIndex(header, leftKey)
+		if err != nil {
+			return fmt.Errorf("%v: %v", args[1], err)
+		}
+		if err := w.Write(append(header, csvFields(rightHeader, rightCols)...)); err != nil {
+			return err
+		}
+		width := len(header)
+		return forEachCSVRecord(r, func(record []string) error {
+			left := make([]string, width)
+			copy(left, record)
+			matches := rightRows[csvField(record, li)]
+			if len(matches) == 0 && leftJoinFromFlag {
+				return w.Write(append(left, make([]string, len(rightCols))...))
+			}
+			for _, match := range matches {
+				if err := w.Write(append(append([]string{}, left...), match...)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// aggregate is a function over a column of each group
+type aggregate struct {
+	fn  string
+	col string
+	idx int
+}
+
+func parseAggregates(header []string, s string) ([]aggregate, error) {
+	var aggs []aggregate
+	for _, a := range strings.Split(s, ",") {
+		split := strings.SplitN(strings.TrimSpace(a), ":", 2)
+		agg := aggregate{fn: split[0], idx: -1}
+		switch agg.fn {
+		case "count", "sum", "mean", "min", "max":
+		default:
+			return nil, fmt.Errorf("unknown aggregate %v", agg.fn)
+		}
+		if len(split) == 2 {
+			agg.col = split[1]
+			idx, err := csvColumnIndex(header, agg.col)
+			if err != nil {
+				return nil, err
+			}
+			agg.idx = idx
+		} else if agg.fn != "count" {
+			return nil, fmt.Errorf("aggregate %v requires a column, ex. %v:price", agg.fn, agg.fn)
+		}
+		aggs = append(aggs, agg)
+	}
+	return aggs, nil
+}
+
+func (a aggregate) name() string {
+	if a.col == "" {
+		return a.fn
+	}
+	return a.fn + "_" + a.col
+}
+
+// apply the aggregate to the rows of a group, empty fields are ignored
+func (a aggregate) apply(rows [][]string) (string, error) {
+	if a.idx < 0 {
+		return strconv.Itoa(len(rows)), nil
+	}
+	var vals []float64
+	count := 0
+	for _, row := range rows {
+		field := strings.TrimSpace(csvField(row, a.idx))
+		if field == "" {
+			continue
+		}
+		count++
+		if a.fn == "count" {
+			continue
+		}
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return "", fmt.Errorf("%v of %v: %q is not a number", a.fn, a.col, field)
+		}
+		vals = append(vals, v)
+	}
+	if a.fn == "count" {
+		return strconv.Itoa(count), nil
+	}
+	if len(vals) == 0 {
+		return "", nil
+	}
+	out := vals[0]
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+		switch {
+		case a.fn == "min" && v < out, a.fn == "max" && v > out:
+			out = v
+		}
+	}
+	switch a.fn {
+	case "sum":
+		out = sum
+	case "mean":
+		out = sum / float64(len(vals))
+	}
+	return strconv.FormatFloat(out, 'f', -1, 64), nil
+}
+
+func csvGroupCmd(cmd *cobra.Command, args []string) error {
+	return csvStream(args, 1, func(header []string, r *csv.Reader, w *csv.Writer) error {
+		idxs, err := csvColumnIndexes(header, args[0])
+		if err != nil {
+			return err
+		}
+		aggs, err := parseAggregates(header, aggFromFlag)
+		if err != nil {
+			return err
+		}
+
+		// groups are written in the order they're first seen
+		var keys []string
+		groupFields := make(map[string][]string)
+		groups := make(map[string][][]string)
+		err = forEachCSVRecord(r, func(record []string) error {
+			fields := csvFields(record, idxs)
+			key := csvKey(fields)
+			if _, found := groups[key]; !found {
+				keys = append(keys, key)
+				groupFields[key] = fields
+			}
+			groups[key] = append(groups[key], record)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		outHeader := csvFields(header, idxs)
+		for _, agg := range aggs {
+			outHeader = append(outHeader, agg.name())
+		}
+		if err := w.Write(outHeader); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			row := groupFields[key]
+			for _, agg := range aggs {
+				v, err := agg.apply(groups[key])
+				if err != nil {
+					return err
+				}
+				row = append(row, v)
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
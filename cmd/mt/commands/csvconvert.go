@@ -0,0 +1,579 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// conversion between csv and markdown tables, json and yaml
+var (
+	CSVToMarkdownCmd = &cobra.Command{
+		Use:   "to-md [file]",
+		Short: "convert csv to an aligned markdown table",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvToMarkdownCmd,
+	}
+	CSVToJSONCmd = &cobra.Command{
+		Use:   "to-json [file]",
+		Short: "convert csv to a json array of objects",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvToJSONCmd,
+	}
+	CSVToYAMLCmd = &cobra.Command{
+		Use:   "to-yaml [file]",
+		Short: "convert csv to a yaml list of maps",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvToYAMLCmd,
+	}
+	CSVFromMarkdownCmd = &cobra.Command{
+		Use:   "from-md [file]",
+		Short: "convert a markdown table to csv",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvFromMarkdownCmd,
+	}
+	CSVFromJSONCmd = &cobra.Command{
+		Use:   "from-json [file]",
+		Short: "convert a json array of objects to csv",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvFromJSONCmd,
+	}
+	CSVFromYAMLCmd = &cobra.Command{
+		Use:   "from-yaml [file]",
+		Short: "convert a yaml list of maps to csv",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  csvFromYAMLCmd,
+	}
+)
+
+var (
+	headerFromFlag string
+	inferFromFlag  bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{CSVToMarkdownCmd, CSVToJSONCmd, CSVToYAMLCmd} {
+		cmd.PersistentFlags().StringVar(&headerFromFlag, "header", "auto",
+			"whether the first row is a header: auto, yes or no")
+	}
+	for _, cmd := range []*cobra.Command{CSVToJSONCmd, CSVToYAMLCmd} {
+		cmd.PersistentFlags().BoolVar(&inferFromFlag, "infer", true,
+			"write numbers and booleans as their type rather than as strings")
+	}
+	CSVCmd.AddCommand(CSVToMarkdownCmd)
+	CSVCmd.AddCommand(CSVToJSONCmd)
+	CSVCmd.AddCommand(CSVToYAMLCmd)
+	CSVCmd.AddCommand(CSVFromMarkdownCmd)
+	CSVCmd.AddCommand(CSVFromJSONCmd)
+	CSVCmd.AddCommand(CSVFromYAMLCmd)
+}
+
+// csvTable is a csv file read entirely into memory
+type csvTable struct {
+	header []string
+	rows   [][]string
+}
+
+// readCSVTable reads the input, using the first row as the header depending
+// on --header, otherwise the columns are named col1, col2...
+func readCSVTable(args []string) (csvTable, error) {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	in, err := openCSVFile(path)
+	if err != nil {
+		return csvTable{}, err
+	}
+	defer in.Close()
+	records, err := newCSVReader(in).ReadAll()
+	if err != nil {
+		return csvTable{}, err
+	}
+	if len(records) == 0 {
+		return csvTable{}, nil
+	}
+
+	width := 0
+	for _, record := range records {
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+	for i := range records {
+		for len(records[i]) < width {
+			records[i] = append(records[i], "")
+		}
+	}
+
+	hasHeader := false
+	switch headerFromFlag {
+	case "yes":
+		hasHeader = true
+	case "no":
+	case "auto":
+		hasHeader = looksLikeHeader(records)
+	default:
+		return csvTable{}, fmt.Errorf("bad --header %v, must be auto, yes or no", headerFromFlag)
+	}
+	if hasHeader {
+		return csvTable{records[0], records[1:]}, nil
+	}
+	header := make([]string, width)
+	for i := range header {
+		header[i] = fmt.Sprintf("col%d", i+1)
+	}
+	return csvTable{header, records}, nil
+}
+
+// looksLikeHeader detects a header row as unique non-empty names, none of
+// which are numbers or booleans
+func looksLikeHeader(records [][]string) bool {
+	seen := make(map[string]bool)
+	for _, field := range records[0] {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			return false
+		}
+		if _, isStr := inferValue(field).(string); !isStr {
+			return false
+		}
+		seen[field] = true
+	}
+	return true
+}
+
+// numbers with leading zeros (such as zip codes) are kept as strings
+var leadingZeroRe = regexp.MustCompile(`^[-+]?0[0-9]`)
+
+// inferValue converts a field to an int, float, bool, nil (when empty) or
+// otherwise leaves it as a string
+func inferValue(field string) interface{} {
+	s := strings.TrimSpace(field)
+	switch strings.ToLower(s) {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if leadingZeroRe.MatchString(s) {
+		return field
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "nN") {
+		return f
+	}
+	return field
+}
+
+// typedColumns infers which columns are numbers or booleans, a column is
+// only typed when all of its non-empty fields are of the same type
+func (t csvTable) typedColumns() []bool {
+	typed := make([]bool, len(t.header))
+	if !inferFromFlag {
+		return typed
+	}
+	for i := range t.header {
+		kind := ""
+		typed[i] = true
+		for _, row := range t.rows {
+			k := ""
+			switch inferValue(row[i]).(type) {
+			case nil:
+				continue
+			case int64, float64:
+				k = "number"
+			case bool:
+				k = "bool"
+			default:
+				k = "string"
+			}
+			if k == "string" || (kind != "" && k != kind) {
+				typed[i] = false
+				break
+			}
+			kind = k
+		}
+	}
+	return typed
+}
+
+// values of the row as their inferred types
+func (t csvTable) values(row []string, typed []bool) []interface{} {
+	vals := make([]interface{}, len(row))
+	for i, field := range row {
+		vals[i] = field
+		if typed[i] {
+			vals[i] = inferValue(field)
+		}
+	}
+	return vals
+}
+
+func csvToMarkdownCmd(cmd *cobra.Command, args []string) error {
+	t, err := readCSVTable(args)
+	if err != nil {
+		return err
+	}
+	fmt.Print(markdownTable(t))
+	return nil
+}
+
+// markdownTable aligns the columns, right aligning columns of numbers
+func markdownTable(t csvTable) string {
+	escape := func(s string) string {
+		s = strings.Replace(s, "|", `\|`, -1)
+		return strings.Replace(s, "\n", "<br>", -1)
+	}
+	widths := make([]int, len(t.header))
+	numeric := make([]bool, len(t.header))
+	for i, name := range t.header {
+		widths[i] = utf8.RuneCountInString(escape(name))
+		if widths[i] < 3 {
+			widths[i] = 3
+		}
+		numeric[i] = len(t.rows) > 0
+	}
+	for _, row := range t.rows {
+		for i, field := range row {
+			if n := utf8.RuneCountInString(escape(field)); n > widths[i] {
+				widths[i] = n
+			}
+			switch inferValue(field).(type) {
+			case int64, float64, nil:
+			default:
+				numeric[i] = false
+			}
+		}
+	}
+
+	var sb strings.Builder
+	writeRow := func(fields []string, align bool) {
+		sb.WriteString("|")
+		for i, field := range fields {
+			field = escape(field)
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(field))
+			if align && numeric[i] {
+				fmt.Fprintf(&sb, " %v%v |", pad, field)
+			} else {
+				fmt.Fprintf(&sb, " %v%v |", field, pad)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(t.header, false)
+	sep := make([]string, len(t.header))
+	for i := range sep {
+		sep[i] = strings.Repeat("-", widths[i])
+		if numeric[i] {
+			sep[i] = sep[i][1:] + ":"
+		}
+	}
+	writeRow(sep, false)
+	for _, row := range t.rows {
+		writeRow(row, true)
+	}
+	return sb.String()
+}
+
+// orderedRow marshals to a json object keeping the order of the columns
+type orderedRow struct {
+	keys []string
+	vals []interface{}
+}
+
+func (r orderedRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(r.vals[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+func csvToJSONCmd(cmd *cobra.Command, args []string) error {
+	t, err := readCSVTable(args)
+	if err != nil {
+		return err
+	}
+	typed := t.typedColumns()
+	rows := make([]orderedRow, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = orderedRow{t.header, t.values(row, typed)}
+	}
+	bz, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bz))
+	return nil
+}
+
+func csvToYAMLCmd(cmd *cobra.Command, args []string) error {
+	t, err := readCSVTable(args)
+	if err != nil {
+		return err
+	}
+	typed := t.typedColumns()
+	rows := make([]yaml.MapSlice, len(t.rows))
+	for i, row := range t.rows {
+		for j, v := range t.values(row, typed) {
+			rows[i] = append(rows[i], yaml.MapItem{Key: t.header[j], Value: v})
+		}
+	}
+	bz, err := yaml.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(bz))
+	return nil
+}
+
+// writeCSVTable writes the table to stdout
+func writeCSVTable(t csvTable) error {
+	w := newCSVWriter(os.Stdout)
+	if err := w.Write(t.header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// tableFromMaps builds a table from rows of ordered keys and values, the
+// columns are the keys in the order they're first seen
+func tableFromMaps(keys [][]string, vals []map[string]string) csvTable {
+	var t csvTable
+	seen := make(map[string]bool)
+	for _, rowKeys := range keys {
+		for _, key := range rowKeys {
+			if !seen[key] {
+				seen[key] = true
+				t.header = append(t.header, key)
+			}
+		}
+	}
+	for _, rowVals := range vals {
+		row := make([]string, len(t.header))
+		for i, key := range t.header {
+			row[i] = rowVals[key]
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+func readInput(args []string) ([]byte, error) {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	}
+	in, err := openCSVFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return ioutil.ReadAll(in)
+}
+
+// separator rows of markdown tables, ex. |---|:--:|
+var mdSeparatorRe = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+// splitMarkdownRow splits on pipes which aren't escaped
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var fields []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case line[i] == '|':
+			fields = append(fields, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	fields = append(fields, strings.TrimSpace(cur.String()))
+	for i := range fields {
+		fields[i] = strings.Replace(fields[i], "<br>", "\n", -1)
+	}
+	return fields
+}
+
+// csvFromMarkdownCmd reads the first table of the input, the row before the
+// separator row is the header
+func csvFromMarkdownCmd(cmd *cobra.Command, args []string) error {
+	bz, err := readInput(args)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(bz))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Contains(line, "|") {
+			lines = append(lines, line)
+		} else if len(lines) > 0 {
+			break // end of the table
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(lines) < 2 || !mdSeparatorRe.MatchString(lines[1]) {
+		return fmt.Errorf("no markdown table found")
+	}
+
+	t := csvTable{header: splitMarkdownRow(lines[0])}
+	for _, line := range lines[2:] {
+		row := splitMarkdownRow(line)
+		for len(row) < len(t.header) {
+			row = append(row, "")
+		}
+		t.rows = append(t.rows, row[:len(t.header)])
+	}
+	return writeCSVTable(t)
+}
+
+// jsonField formats a json value as a field, nested values are kept as json
+func jsonField(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	bz, err := json.Marshal(v)
+	return string(bz), err
+}
+
+func csvFromJSONCmd(cmd *cobra.Command, args []string) error {
+	bz, err := readInput(args)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("expected a json array of objects")
+	}
+
+	// objects are read token by token to keep the order of their keys
+	var keys [][]string
+	var vals []map[string]string
+	for dec.More() {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return fmt.Errorf("expected a json array of objects")
+		}
+		var rowKeys []string
+		rowVals := make(map[string]string)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			field, err := jsonField(v)
+			if err != nil {
+				return err
+			}
+			rowKeys = append(rowKeys, key)
+			rowVals[key] = field
+		}
+		if _, err := dec.Token(); err != nil { // closing brace
+			return err
+		}
+		keys = append(keys, rowKeys)
+		vals = append(vals, rowVals)
+	}
+	return writeCSVTable(tableFromMaps(keys, vals))
+}
+
+// yamlField formats a yaml value as a field, nested values are kept as yaml
+func yamlField(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int, int64, uint64, bool:
+		return fmt.Sprint(v), nil
+	}
+	bz, err := yaml.Marshal(v)
+	return strings.TrimSpace(string(bz)), err
+}
+
+func csvFromYAMLCmd(cmd *cobra.Command, args []string) error {
+	bz, err := readInput(args)
+	if err != nil {
+		return err
+	}
+	var rows []yaml.MapSlice
+	if err := yaml.Unmarshal(bz, &rows); err != nil {
+		return fmt.Errorf("expected a yaml list of maps: %v", err)
+	}
+	var keys [][]string
+	var vals []map[string]string
+	for _, row := range rows {
+		var rowKeys []string
+		rowVals := make(map[string]string)
+		for _, item := range row {
+			key := fmt.Sprint(item.Key)
+			field, err := yamlField(item.Value)
+			if err != nil {
+				return err
+			}
+			rowKeys = append(rowKeys, key)
+			rowVals[key] = field
+		}
+		keys = append(keys, rowKeys)
+		vals = append(vals, rowVals)
+	}
+	return writeCSVTable(tableFromMaps(keys, vals))
+}
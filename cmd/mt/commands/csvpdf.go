@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/rigelrozanski/common"
+	"github.com/spf13/cobra"
+)
+
+// printable csv tables
+var (
+	CSVPDFCmd = &cobra.Command{
+		Use:   "pdf [file]",
+		Short: "render csv as a paginated pdf table",
+		Long: `render csv as a paginated pdf table
+
+The header is repeated on each page, rows are striped and columns of
+numbers are right aligned. Columns too wide for the page are narrowed
+with their text cut short.`,
+		Args: cobra.ExactArgs(1),
+		RunE: csvPDFCmd,
+	}
+)
+
+var (
+	landscapeFromFlag bool
+	printFromFlag     bool
+	pdfOutFromFlag    string
+	fontSizeFromFlag  float64
+)
+
+func init() {
+	CSVPDFCmd.PersistentFlags().StringVar(&headerFromFlag, "header", "auto",
+		"whether the first row is a header: auto, yes or no")
+	CSVPDFCmd.PersistentFlags().BoolVar(&landscapeFromFlag, "landscape", false,
+		"lay the table out on landscape pages")
+	CSVPDFCmd.PersistentFlags().BoolVar(&printFromFlag, "print", false,
+		"send the pdf to the printer with lp")
+	CSVPDFCmd.PersistentFlags().StringVarP(&pdfOutFromFlag, "out", "o", "",
+		"output file (default is the input file with a .pdf extension)")
+	CSVPDFCmd.PersistentFlags().Float64Var(&fontSizeFromFlag, "font-size", 9,
+		"font size in points")
+	CSVCmd.AddCommand(CSVPDFCmd)
+}
+
+func csvPDFCmd(cmd *cobra.Command, args []string) error {
+	if fontSizeFromFlag <= 0 {
+		return fmt.Errorf("bad font size %v", fontSizeFromFlag)
+	}
+	t, err := readCSVTable(args)
+	if err != nil {
+		return err
+	}
+	if len(t.header) == 0 {
+		return fmt.Errorf("no rows found in %v", args[0])
+	}
+
+	outFile := pdfOutFromFlag
+	if outFile == "" {
+		outFile = "table.pdf"
+		if args[0] != "-" {
+			outFile = strings.TrimSuffix(args[0], path.Ext(args[0])) + ".pdf"
+		}
+	}
+	if err := writeTablePDF(t, outFile); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v\n", outFile)
+
+	if !printFromFlag {
+		return nil
+	}
+	command := fmt.Sprintf("lp %v", outFile)
+	output, err := common.Execute(command)
+	fmt.Printf("%v\n%v\n", command, output)
+	return err
+}
+
+// columnWidths fits the natural width of each column to the available width,
+// when there isn't enough room the widest columns are narrowed to a common
+// width
+func columnWidths(natural []float64, available float64) []float64 {
+	capped := func(limit float64) (widths []float64, total float64) {
+		for _, w := range natural {
+			w = math.Min(w, limit)
+			widths = append(widths, w)
+			total += w
+		}
+		return widths, total
+	}
+	lo, hi := 0.0, 0.0
+	for _, w := range natural {
+		hi = math.Max(hi, w)
+	}
+	if _, total := capped(hi); total <= available {
+		return natural
+	}
+	for i := 0; i < 50; i++ {
+		mid := (lo + hi) / 2
+		if _, total := capped(mid); total > available {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	widths, _ := capped(lo)
+	return widths
+}
+
+// fitText cuts the text short with "..." to fit within the width
+func fitText(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	rs := []rune(s)
+	for len(rs) > 0 && pdf.GetStringWidth(string(rs)+"...") > width {
+		rs = rs[:len(rs)-1]
+	}
+	return string(rs) + "..."
+}
+
+func writeTablePDF(t csvTable, outFile string) error {
+	orientation := "P"
+	if landscapeFromFlag {
+		orientation = "L"
+	}
+	margin := 0.5
+	padding := 0.05
+	pdf := gofpdf.New(orientation, "in", "Letter", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, margin)
+	pdf.SetCellMargin(padding)
+	pdf.SetDrawColor(160, 160, 160)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, pageHeight := pdf.GetPageSize()
+
+	// natural widths include the bold header
+	numeric := make([]bool, len(t.header))
+	natural := make([]float64, len(t.header))
+	pdf.SetFont("courier", "B", fontSizeFromFlag)
+	for i, name := range t.header {
+		natural[i] = pdf.GetStringWidth(tr(name)) + 2*padding
+		numeric[i] = len(t.rows) > 0
+	}
+	pdf.SetFont("courier", "", fontSizeFromFlag)
+	for _, row := range t.rows {
+		for i, field := range row {
+			natural[i] = math.Max(natural[i], pdf.GetStringWidth(tr(field))+2*padding)
+			switch inferValue(field).(type) {
+			case int64, float64, nil:
+			default:
+				numeric[i] = false
+			}
+		}
+	}
+	widths := columnWidths(natural, pageWidth-2*margin)
+
+	rowHeight := fontSizeFromFlag * 1.5 / 72
+	footerHeight := 0.3
+	rowsPerPage := int((pageHeight - 2*margin - footerHeight - rowHeight) / rowHeight)
+	if rowsPerPage < 1 {
+		return fmt.Errorf("font size %v is too large for the page", fontSizeFromFlag)
+	}
+	pages := (len(t.rows) + rowsPerPage - 1) / rowsPerPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	drawRow := func(fields []string, header, fill bool) {
+		pdf.SetX(margin)
+		for i, field := range fields {
+			align := "L"
+			if numeric[i] && !header {
+				align = "R"
+			}
+			text := fitText(pdf, tr(field), widths[i]-2*padding)
+			pdf.CellFormat(widths[i], rowHeight, text, "1", 0, align+"M", fill, 0, "")
+		}
+		pdf.Ln(rowHeight)
+	}
+
+	for page := 0; page < pages; page++ {
+		pdf.AddPage()
+
+		// the header is repeated on each page
+		pdf.SetFont("courier", "B", fontSizeFromFlag)
+		pdf.SetFillColor(200, 200, 200)
+		drawRow(t.header, true, true)
+
+		// rows are striped like the habits sheet
+		pdf.SetFont("courier", "", fontSizeFromFlag)
+		pdf.SetFillColor(230, 230, 230)
+		start := page * rowsPerPage
+		for i := start; i < start+rowsPerPage && i < len(t.rows); i++ {
+			drawRow(t.rows[i], false, (i-start)%2 == 1)
+		}
+
+		pdf.SetXY(margin, pageHeight-margin-footerHeight/2)
+		pdf.CellFormat(pageWidth-2*margin, footerHeight/2,
+			fmt.Sprintf("%d of %d", page+1, pages), "", 0, "C", false, 0, "")
+	}
+	return pdf.OutputFileAndClose(outFile)
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// exchange rates are read from a local file so conversions work offline, the
+// file may be updated by hand or by script, ex:
+//   {
+//     "base": "USD",
+//     "date": "2026-10-01",
+//     "rates": {"EUR": 0.92, "CAD": 1.37}
+//   }
+// where each rate is the amount of the currency equal to one of the base
+
+// ratesFile is the file format of the exchange rates
+type ratesFile struct {
+	Base  string             `json:"base"`
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// loaded exchange rate info, used to report the age of the rates
+var (
+	ratesPath  string
+	ratesAsOf  time.Time
+	ratesError error
+)
+
+// defaultRatesPath is $HOME/.multitool_rates.json unless set by the config
+// with "rates-file"
+func defaultRatesPath() (string, error) {
+	if p := viper.GetString("rates-file"); p != "" {
+		return homedir.Expand(p)
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".multitool_rates.json"), nil
+}
+
+// loadCurrencyRates registers each currency within the rates file as a unit,
+// a missing rates file is not an error
+func loadCurrencyRates() error {
+	p, err := defaultRatesPath()
+	if err != nil {
+		return err
+	}
+	bz, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		ratesError = fmt.Errorf("no exchange rates file at %v", p)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var rf ratesFile
+	if err := json.Unmarshal(bz, &rf); err != nil {
+		return fmt.Errorf("bad exchange rates file %v: %v", p, err)
+	}
+	if rf.Base == "" {
+		return fmt.Errorf("bad exchange rates file %v: missing base currency", p)
+	}
+
+	// the age of the rates is from their date, otherwise from the file
+	ratesAsOf, err = time.Parse("2006-01-02", rf.Date)
+	if err != nil {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		ratesAsOf = info.ModTime()
+	}
+
+	registerCurrency(rf.Base, 1)
+	for code, rate := range rf.Rates {
+		if rate <= 0 {
+			return fmt.Errorf("bad exchange rate for %v: %v", code, rate)
+		}
+		registerCurrency(code, 1/rate)
+	}
+	ratesPath = p
+	ratesError = nil
+	return nil
+}
+
+// registerCurrency registers a currency by its value in the base currency,
+// never replacing a physical unit of the same name
+func registerCurrency(code string, value float64) {
+	if u, found := unitRegistry[code]; found && u.dim != dimMoney {
+		return
+	}
+	registerUnit(unitDef{code, dimMoney, value, 0})
+}
+
+// ratesNote describes where the exchange rates came from and their age
+func ratesNote() string {
+	if ratesPath == "" {
+		return ""
+	}
+	days := int(time.Since(ratesAsOf).Hours() / 24)
+	age := fmt.Sprintf("%d days old", days)
+	if days == 1 {
+		age = "1 day old"
+	}
+	return fmt.Sprintf("exchange rates from %v as of %v (%v)",
+		ratesPath, ratesAsOf.Format("2006-01-02"), age)
+}
+
+// unknownUnitError notes when no exchange rates are loaded as the unit may be
+// a currency
+func unknownUnitError(name string) error {
+	if ratesError != nil && isCurrencyCode(name) {
+		return fmt.Errorf("unknown unit %v (%v)", name, ratesError)
+	}
+	return fmt.Errorf("unknown unit %v", name)
+}
+
+func isCurrencyCode(name string) bool {
+	if len(name) != 3 {
+		return false
+	}
+	for _, r := range name {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// pathRatesNote returns the rates note if the conversion involves currency
+func pathRatesNote(path []conversionStep) string {
+	for _, step := range path {
+		if u, found := lookupUnit(step.from); found && u.dim == dimMoney {
+			return ratesNote()
+		}
+	}
+	return ""
+}
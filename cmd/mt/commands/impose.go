@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// imposition arranges the pages of a book onto the sides of printed sheets.
+// The sheets are printed double sided, flipping on the edge parallel to the
+// columns, so the back of a slot is the slot of the same row in the mirrored
+// column.
+
+// impLayout is the arrangement of pages on each side of a sheet
+type impLayout struct {
+	cols, rows int
+	landscape  bool
+
+	// folded sheets are nested into saddle stitched signatures, otherwise
+	// the printed stack is cut into a pile per slot and the piles stacked
+	folded bool
+}
+
+var impLayouts = map[string]impLayout{
+	"2-up":   {cols: 2, rows: 1, landscape: true},
+	"4-up":   {cols: 2, rows: 2},
+	"8-up":   {cols: 4, rows: 2, landscape: true},
+	"saddle": {cols: 2, rows: 1, landscape: true, folded: true},
+}
+
+func layoutNames() string {
+	var names []string
+	for name := range impLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// slots is the number of pages on each side of a sheet
+func (l impLayout) slots() int {
+	return l.cols * l.rows
+}
+
+// slotPos is the column and row of a slot
+func (l impLayout) slotPos(slot int) (col, row int) {
+	return slot % l.cols, slot / l.cols
+}
+
+// backSlot is the slot on the back of the sheet behind the slot
+func (l impLayout) backSlot(slot int) int {
+	col, row := l.slotPos(slot)
+	return row*l.cols + l.cols - 1 - col
+}
+
+// placement is the page printed within a slot, page is -1 for a blank,
+// shift is the horizontal offset (inches) compensating for creep
+type placement struct {
+	page  int
+	shift float64
+}
+
+// imposition is the placement of each slot of each side, the sides of each
+// sheet are listed front then back
+type imposition struct {
+	layout impLayout
+	sides  [][]placement
+}
+
+// sheets is the number of printed sheets
+func (imp imposition) sheets() int {
+	return len(imp.sides) / 2
+}
+
+// order is the source page of each slot, side by side, as for a printer
+// which places several pages on each side itself
+func (imp imposition) order() []int {
+	var pages []int
+	for _, side := range imp.sides {
+		for _, p := range side {
+			pages = append(pages, p.page)
+		}
+	}
+	return pages
+}
+
+func (imp *imposition) addSheets(n int) {
+	for i := 0; i < 2*n; i++ {
+		side := make([]placement, imp.layout.slots())
+		for j := range side {
+			side[j].page = -1
+		}
+		imp.sides = append(imp.sides, side)
+	}
+}
+
+// impose places the pages (0 to pages-1) with the layout. Folded layouts are
+// split into signatures of sigSheets sheets, or a single signature when 0,
+// and the pages of each inner sheet are shifted toward the fold by creep
+// (about the thickness of the paper) more than those of the sheet outside it.
+func impose(pages int, l impLayout, sigSheets int, creep float64) (imposition, error) {
+	imp := imposition{layout: l}
+	if pages < 1 {
+		return imp, errors.New("no pages to impose")
+	}
+	if sigSheets < 0 {
+		return imp, fmt.Errorf("bad signature size %d", sigSheets)
+	}
+	if !l.folded && (sigSheets > 0 || creep != 0) {
+		return imp, errors.New("signatures and creep only apply to folded layouts (saddle)")
+	}
+
+	page := func(p int) int {
+		if p >= pages {
+			return -1
+		}
+		return p
+	}
+
+	if !l.folded {
+		// each slot of the front is a pile of consecutive pages, the back
+		// of each sheet continuing the page of its front
+		perSheet := 2 * l.slots()
+		sheets := (pages + perSheet - 1) / perSheet
+		pile := 2 * sheets
+		imp.addSheets(sheets)
+		for s := 0; s < sheets; s++ {
+			front, back := imp.sides[2*s], imp.sides[2*s+1]
+			for slot := 0; slot < l.slots(); slot++ {
+				front[slot].page = page(slot*pile + 2*s)
+				back[l.backSlot(slot)].page = page(slot*pile + 2*s + 1)
+			}
+		}
+		return imp, nil
+	}
+
+	// folded signatures, the outer sheet holding the first two and last two
+	// pages of the signature
+	padded := (pages + 3) / 4 * 4
+	sigPages := padded
+	if sigSheets > 0 {
+		sigPages = 4 * sigSheets
+	}
+	for start := 0; start < padded; start += sigPages {
+		n := sigPages
+		if start+n > padded {
+			n = padded - start
+		}
+		first := imp.sheets()
+		imp.addSheets(n / 4)
+		for s := 0; s < n/4; s++ {
+			front, back := imp.sides[2*(first+s)], imp.sides[2*(first+s)+1]
+			shift := float64(s) * creep
+			front[0] = placement{page(start + n - 1 - 2*s), shift}
+			front[1] = placement{page(start + 2*s), -shift}
+			back[0] = placement{page(start + 2*s + 1), shift}
+			back[1] = placement{page(start + n - 2 - 2*s), -shift}
+		}
+	}
+	return imp, nil
+}
+
+var (
+	layoutFromFlag  string
+	sigSizeFromFlag int
+	creepFromFlag   float64
+)
+
+// newImposition imposes the pages using the layout flags
+func newImposition(pages int) (imposition, error) {
+	l, ok := impLayouts[layoutFromFlag]
+	if !ok {
+		return imposition{}, fmt.Errorf("unknown layout %v, must be one of %v", layoutFromFlag, layoutNames())
+	}
+	return impose(pages, l, sigSizeFromFlag, creepFromFlag)
+}
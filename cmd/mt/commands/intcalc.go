@@ -0,0 +1,392 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// arbitrary precision integer and rational calculator used by the root
+// command, supporting 0x, 0b and 0o literals along with bitwise operators
+//   |        bitwise or (lowest precedence)
+//   xor      bitwise exclusive or
+//   &        bitwise and
+//   << >>    shifts
+//   + -
+//   * / %    (division is exact, producing rationals)
+//   - ~      unary negation and bitwise not
+//   ^ **     exponentiation (highest precedence, right associative)
+
+var (
+	// expressions which can only be evaluated in programmer mode, the logical
+	// && and || are left to the floating point calculator
+	programmerExprRe = regexp.MustCompile(`0[xXbBoO][0-9a-fA-F_]|<<|>>|(?:^|[^&])&(?:[^&]|$)|(?:^|[^|])\|(?:[^|]|$)|~|\bxor\b`)
+
+	// expressions of only integers which are evaluated precisely
+	integerExprRe = regexp.MustCompile(`^[0-9\s+\-*/%^()]*[0-9][0-9\s+\-*/%^()]*$`)
+)
+
+// maxIntResultBits limits the size of powers and shifts which would
+// otherwise exhaust memory, about 30000 decimal digits
+const maxIntResultBits = 100000
+
+func isProgrammerExpr(input string) bool { return programmerExprRe.MatchString(input) }
+func isIntegerExpr(input string) bool    { return integerExprRe.MatchString(input) }
+
+type intParser struct {
+	toks []string
+	pos  int
+}
+
+func tokenizeInt(input string) ([]string, error) {
+	var toks []string
+	rs := []rune(input)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) ||
+				rs[j] == '_' || rs[j] == '.') {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(rs) && unicode.IsLetter(rs[j]) {
+				j++
+			}
+			toks = append(toks, string(rs[i:j]))
+			i = j
+		default:
+			op := string(r)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "**", "<<", ">>":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/%^()&|~<<>>**", op) {
+				return nil, fmt.Errorf("unexpected character %q", r)
+			}
+			toks = append(toks, op)
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+// parseIntLiteral parses decimal, 0x, 0b and 0o literals as well as exact
+// decimals such as 1.25
+func parseIntLiteral(s string) (*big.Rat, error) {
+	clean := strings.Replace(s, "_", "", -1)
+	if len(clean) > 2 && clean[0] == '0' && strings.ContainsAny(clean[1:2], "xXbBoO") {
+		n, ok := new(big.Int).SetString(clean, 0)
+		if !ok {
+			return nil, fmt.Errorf("bad number %v", s)
+		}
+		return new(big.Rat).SetInt(n), nil
+	}
+	r, ok := new(big.Rat).SetString(clean)
+	if !ok {
+		return nil, fmt.Errorf("bad number %v", s)
+	}
+	return r, nil
+}
+
+// evalIntExpr evaluates the expression with arbitrary precision
+func evalIntExpr(input string) (*big.Rat, error) {
+	toks, err := tokenizeInt(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &intParser{toks: toks}
+	r, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	return r, nil
+}
+
+// binary operators by precedence, lowest first
+var intBinaryOps = [][]string{
+	{"|"},
+	{"xor"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *intParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *intParser) parseBinary(level int) (*big.Rat, error) {
+	if level == len(intBinaryOps) {
+		return p.parseUnary()
+	}
+	lhs, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range intBinaryOps[level] {
+			if op == o {
+				found = true
+			}
+		}
+		if !found {
+			return lhs, nil
+		}
+		p.pos++
+		rhs, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs, err = applyIntOp(op, lhs, rhs)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *intParser) parseUnary() (*big.Rat, error) {
+	switch p.peek() {
+	case "-":
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return r.Neg(r), nil
+	case "+":
+		p.pos++
+		return p.parseUnary()
+	case "~":
+		p.pos++
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		n, err := ratToInt(r, "~")
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Rat).SetInt(n.Not(n)), nil
+	}
+	return p.parsePower()
+}
+
+func (p *intParser) parsePower() (*big.Rat, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "^" || op == "**" {
+		p.pos++
+		exp, err := p.parseUnary() // right associative
+		if err != nil {
+			return nil, err
+		}
+		return ratPow(base, exp)
+	}
+	return base, nil
+}
+
+func (p *intParser) parsePrimary() (*big.Rat, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, errors.New("unexpected end of expression")
+	}
+	p.pos++
+	if tok == "(" {
+		r, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return r, nil
+	}
+	if unicode.IsDigit(rune(tok[0])) || tok[0] == '.' {
+		return parseIntLiteral(tok)
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+func ratToInt(r *big.Rat, op string) (*big.Int, error) {
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%v requires integers, not %v", op, r.RatString())
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+func ratPow(base, exp *big.Rat) (*big.Rat, error) {
+	if !exp.IsInt() {
+		return nil, fmt.Errorf("exponent must be an integer, not %v", exp.RatString())
+	}
+	e := new(big.Int).Set(exp.Num())
+	neg := e.Sign() < 0
+	e.Abs(e)
+
+	// powers of 0, 1 and -1 only depend on the parity of the exponent,
+	// otherwise the size of the result is estimated before calculating it
+	bits := base.Num().BitLen()
+	if d := base.Denom().BitLen(); d > bits {
+		bits = d
+	}
+	if base.IsInt() && bits <= 1 {
+		if e.Cmp(big.NewInt(2)) > 0 {
+			e.SetInt64(2 + int64(e.Bit(0)))
+		}
+	} else if !e.IsInt64() || e.Int64() > maxIntResultBits/int64(bits) {
+		return nil, fmt.Errorf("exponent %v too large", exp.RatString())
+	}
+	num := new(big.Int).Exp(base.Num(), e, nil)
+	den := new(big.Int).Exp(base.Denom(), e, nil)
+	if neg {
+		if num.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+func applyIntOp(op string, a, b *big.Rat) (*big.Rat, error) {
+	switch op {
+	case "+":
+		return new(big.Rat).Add(a, b), nil
+	case "-":
+		return new(big.Rat).Sub(a, b), nil
+	case "*":
+		return new(big.Rat).Mul(a, b), nil
+	case "/":
+		if b.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return new(big.Rat).Quo(a, b), nil
+	}
+
+	// remaining operators require integers
+	x, err := ratToInt(a, op)
+	if err != nil {
+		return nil, err
+	}
+	y, err := ratToInt(b, op)
+	if err != nil {
+		return nil, err
+	}
+	out := new(big.Int)
+	switch op {
+	case "%":
+		if y.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		out.Rem(x, y)
+	case "&":
+		out.And(x, y)
+	case "|":
+		out.Or(x, y)
+	case "xor":
+		out.Xor(x, y)
+	case "<<":
+		if y.Sign() < 0 {
+			return nil, fmt.Errorf("bad shift amount %v", y)
+		}
+		if !y.IsInt64() || int64(x.BitLen())+y.Int64() > maxIntResultBits {
+			return nil, fmt.Errorf("shift amount %v too large", y)
+		}
+		out.Lsh(x, uint(y.Int64()))
+	case ">>":
+		if y.Sign() < 0 {
+			return nil, fmt.Errorf("bad shift amount %v", y)
+		}
+
+		// shifting out every bit leaves 0, or -1 when negative
+		n := uint(x.BitLen())
+		if y.IsUint64() && y.Uint64() < uint64(n) {
+			n = uint(y.Uint64())
+		}
+		out.Rsh(x, n)
+	default:
+		return nil, fmt.Errorf("unknown operator %v", op)
+	}
+	return new(big.Rat).SetInt(out), nil
+}
+
+// parseBases parses a list of bases such as "2,8,16", or "all"
+func parseBases(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s == "all" {
+		return []int{2, 8, 16}, nil
+	}
+	var bases []int
+	for _, b := range strings.Split(s, ",") {
+		base, err := strconv.Atoi(strings.TrimSpace(b))
+		if err != nil || base < 2 || base > 36 {
+			return nil, fmt.Errorf("bad base %v, must be between 2 and 36", b)
+		}
+		bases = append(bases, base)
+	}
+	return bases, nil
+}
+
+// ratDecimal is the decimal expansion of the rational to 20 places
+func ratDecimal(r *big.Rat) string {
+	return strings.TrimSuffix(strings.TrimRight(r.FloatString(20), "0"), ".")
+}
+
+// formatIntResult prints integers in decimal followed by each of the bases,
+// and rationals as a fraction along with their decimal expansion
+func formatIntResult(r *big.Rat, bases []int) (string, error) {
+	if !r.IsInt() {
+		if len(bases) > 0 {
+			return "", fmt.Errorf("cannot print %v in other bases as it's not an integer", r.RatString())
+		}
+		return fmt.Sprintf("%v (%v)", r.RatString(), ratDecimal(r)), nil
+	}
+	n := r.Num()
+	lines := []string{n.String()}
+	for _, base := range bases {
+		if base == 10 {
+			continue
+		}
+		abs := new(big.Int).Abs(n)
+		sign := ""
+		if n.Sign() < 0 {
+			sign = "-"
+		}
+		switch base {
+		case 2:
+			lines = append(lines, sign+"0b"+abs.Text(2))
+		case 8:
+			lines = append(lines, sign+"0o"+abs.Text(8))
+		case 16:
+			lines = append(lines, sign+"0x"+abs.Text(16))
+		default:
+			lines = append(lines, fmt.Sprintf("%v%v (base %d)", sign, abs.Text(base), base))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,55 @@
+package commands
+
+import "testing"
+
+func TestIsProgrammerExpr(t *testing.T) {
+	cases := map[string]bool{
+		"0xff":             true,
+		"6 & 3":            true,
+		"6&3":              true,
+		"6 | 3":            true,
+		"1 << 4":           true,
+		"~5":               true,
+		"5 xor 3":          true,
+		"1 > 0 && 2 > 1":   false,
+		"1 > 0 || 2 > 1":   false,
+		"(1 > 0)&&(2 > 1)": false,
+		"2 + 3":            false,
+	}
+	for expr, expected := range cases {
+		if got := isProgrammerExpr(expr); got != expected {
+			t.Errorf("%q: got %v, expected %v", expr, got, expected)
+		}
+	}
+}
+
+func TestEvalIntExprLimits(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected string // empty when an error is expected
+	}{
+		{"2^64", "18446744073709551616"},
+		{"2^-2", "1/4"},
+		{"1^4000000000", "1"},
+		{"(-1)^4000000001", "-1"},
+		{"0^4000000000", "0"},
+		{"2^4000000000", ""},
+		{"10^40000", ""},
+		{"1 << 4", "16"},
+		{"1 << 4000000000", ""},
+		{"256 >> 4000000000", "0"},
+		{"-256 >> 4000000000", "-1"},
+		{"1 << -1", ""},
+	}
+	for _, c := range cases {
+		res, err := evalIntExpr(c.expr)
+		switch {
+		case c.expected == "" && err == nil:
+			t.Errorf("%q: expected an error, got %v", c.expr, res.RatString())
+		case c.expected != "" && err != nil:
+			t.Errorf("%q: %v", c.expr, err)
+		case c.expected != "" && res.RatString() != c.expected:
+			t.Errorf("%q: got %v, expected %v", c.expr, res.RatString(), c.expected)
+		}
+	}
+}
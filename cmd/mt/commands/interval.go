@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"errors"
+	"math"
+)
+
+// interval is an amount known only to be between lo and hi, such as the
+// juice of a lemon, a precise amount has lo == hi
+type interval struct {
+	lo, hi float64
+}
+
+func exact(v float64) interval { return interval{v, v} }
+
+func (i interval) isExact() bool { return i.lo == i.hi }
+
+// format prints the interval as "between X – Y" or as a single amount if
+// precise
+func (i interval) format(formatAmount func(float64) string) string {
+	lo, hi := formatAmount(i.lo), formatAmount(i.hi)
+	if lo == hi {
+		return lo
+	}
+	return "between " + lo + " – " + hi
+}
+
+// bounds returns the smallest interval containing all the values
+func bounds(vals ...float64) interval {
+	out := interval{math.Inf(1), math.Inf(-1)}
+	for _, v := range vals {
+		out.lo = math.Min(out.lo, v)
+		out.hi = math.Max(out.hi, v)
+	}
+	return out
+}
+
+func (i interval) neg() interval { return interval{-i.hi, -i.lo} }
+
+func (i interval) add(j interval) interval { return interval{i.lo + j.lo, i.hi + j.hi} }
+
+func (i interval) sub(j interval) interval { return i.add(j.neg()) }
+
+func (i interval) mul(j interval) interval {
+	return bounds(i.lo*j.lo, i.lo*j.hi, i.hi*j.lo, i.hi*j.hi)
+}
+
+func (i interval) div(j interval) (interval, error) {
+	if j.lo <= 0 && j.hi >= 0 {
+		return interval{}, errors.New("division by zero")
+	}
+	return i.mul(interval{1 / j.hi, 1 / j.lo}), nil
+}
+
+func (i interval) scale(factor float64) interval {
+	return bounds(i.lo*factor, i.hi*factor)
+}
+
+// pow raises the interval to a precise power
+func (i interval) pow(exp float64) interval {
+	out := bounds(math.Pow(i.lo, exp), math.Pow(i.hi, exp))
+
+	// an even power of an interval spanning zero has a minimum of zero
+	if i.lo < 0 && i.hi > 0 && exp > 0 && math.Mod(exp, 2) == 0 {
+		out.lo = 0
+	}
+	return out
+}
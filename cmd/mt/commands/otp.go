@@ -0,0 +1,486 @@
+package commands
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// one-time codes
+var (
+	OTPCmd = &cobra.Command{
+		Use:   "otp [name]",
+		Short: "TOTP (RFC 6238) and HOTP (RFC 4226) one-time codes",
+		Long: `TOTP (RFC 6238) and HOTP (RFC 4226) one-time codes
+
+Keys are kept in a passphrase encrypted file ($HOME/.multitool_otp unless
+--file is set) or may be listed in the config as base32 secrets or otpauth://
+URIs, ex:
+
+    otp:
+      github: JBSWY3DPEHPK3PXP
+      aws: otpauth://totp/AWS:jane?secret=...&issuer=AWS
+
+The passphrase is prompted for unless $MT_PASSPHRASE is set. The counter of
+HOTP keys within the file is advanced and saved before each code is given,
+keys within the config are read only.`,
+		Args: cobra.ExactArgs(1),
+		RunE: otpCmd,
+	}
+
+	OTPAddCmd = &cobra.Command{
+		Use:   "add [name] [secret]",
+		Short: "add a base32 secret to the otp file",
+		Args:  cobra.ExactArgs(2),
+		RunE:  otpAddCmd,
+	}
+
+	OTPImportCmd = &cobra.Command{
+		Use:   "import [uris...]",
+		Short: "add otpauth:// URIs to the otp file, read one per line from --in without arguments",
+		RunE:  otpImportCmd,
+	}
+
+	OTPListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list the otp keys of the file and config",
+		Args:  cobra.NoArgs,
+		RunE:  otpListCmd,
+	}
+
+	OTPRmCmd = &cobra.Command{
+		Use:   "rm [name]",
+		Short: "remove a key from the otp file",
+		Args:  cobra.ExactArgs(1),
+		RunE:  otpRmCmd,
+	}
+)
+
+var (
+	otpIO              textIO
+	otpImportIO        textIO
+	otpFileFromFlag    string
+	hotpFromFlag       bool
+	otpDigitsFromFlag  int
+	periodFromFlag     int
+	algorithmFromFlag  string
+	counterFromFlag    uint64
+	issuerFromFlag     string
+	otpCounterFromFlag int64
+)
+
+func init() {
+	OTPCmd.PersistentFlags().StringVar(&otpFileFromFlag, "file", "",
+		"encrypted otp file (default $HOME/.multitool_otp)")
+	addTextIOFlags(OTPCmd, &otpIO, false)
+	OTPCmd.Flags().Int64Var(&otpCounterFromFlag, "counter", -1,
+		"use this counter for an HOTP key rather than the stored one")
+
+	OTPAddCmd.Flags().BoolVar(&hotpFromFlag, "hotp", false,
+		"counter based (HOTP) rather than time based (TOTP)")
+	OTPAddCmd.Flags().IntVar(&otpDigitsFromFlag, "digits", 6,
+		"digits of each code, 6 to 8")
+	OTPAddCmd.Flags().IntVar(&periodFromFlag, "period", 30,
+		"seconds each TOTP code is valid for")
+	OTPAddCmd.Flags().StringVar(&algorithmFromFlag, "algorithm", "SHA1",
+		"hmac algorithm, SHA1, SHA256 or SHA512")
+	OTPAddCmd.Flags().Uint64Var(&counterFromFlag, "counter", 0,
+		"initial HOTP counter")
+	OTPAddCmd.Flags().StringVar(&issuerFromFlag, "issuer", "",
+		"issuer of the key, ex. GitHub")
+	OTPImportCmd.Flags().StringVar(&otpImportIO.in, "in", ioClipboard,
+		"read from a file, - for stdin, or clipboard")
+
+	OTPCmd.AddCommand(OTPAddCmd, OTPImportCmd, OTPListCmd, OTPRmCmd)
+	RootCmd.AddCommand(OTPCmd)
+}
+
+// otpKey is an otp secret and its parameters
+type otpKey struct {
+	Issuer    string `json:"issuer,omitempty"`
+	Secret    string `json:"secret"`
+	HOTP      bool   `json:"hotp,omitempty"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period,omitempty"`
+	Counter   uint64 `json:"counter,omitempty"`
+}
+
+func (k otpKey) kind() string {
+	if k.HOTP {
+		return "hotp"
+	}
+	return "totp"
+}
+
+// decodeSecret decodes a base32 secret, which is often written in lower
+// case, in groups, or without padding
+func decodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("the secret isn't valid base32")
+	}
+	return key, nil
+}
+
+func otpHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "SHA1", "":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %v, must be SHA1, SHA256 or SHA512", algorithm)
+}
+
+// validate checks the secret and parameters
+func (k otpKey) validate() error {
+	if _, err := decodeSecret(k.Secret); err != nil {
+		return err
+	}
+	if _, err := otpHash(k.Algorithm); err != nil {
+		return err
+	}
+	if k.Digits < 6 || k.Digits > 8 {
+		return fmt.Errorf("bad digits %d, must be 6 to 8", k.Digits)
+	}
+	if !k.HOTP && k.Period < 1 {
+		return fmt.Errorf("bad period %d", k.Period)
+	}
+	return nil
+}
+
+// hotp is the RFC 4226 code of the counter, the hmac of the counter is
+// dynamically truncated to 31 bits and reduced to the digits
+func hotp(key []byte, counter uint64, digits int, newHash func() hash.Hash) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(newHash, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
+
+// code is the code of the key at the time, for TOTP keys the counter is the
+// number of periods since the unix epoch (RFC 6238)
+func (k otpKey) code(now time.Time) (string, error) {
+	key, err := decodeSecret(k.Secret)
+	if err != nil {
+		return "", err
+	}
+	newHash, err := otpHash(k.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	counter := k.Counter
+	if !k.HOTP {
+		counter = uint64(now.Unix()) / uint64(k.Period)
+	}
+	return hotp(key, counter, k.Digits, newHash), nil
+}
+
+// remaining is how long the current TOTP code is valid for
+func (k otpKey) remaining(now time.Time) time.Duration {
+	period := int64(k.Period)
+	return time.Duration(period-now.Unix()%period) * time.Second
+}
+
+// parseOTPURI parses a key URI as found within otp qr codes, ex.
+// otpauth://totp/GitHub:jane?secret=JBSWY3DPEHPK3PXP&issuer=GitHub
+func parseOTPURI(uri string) (name string, k otpKey, err error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return "", otpKey{}, err
+	}
+	if u.Scheme != "otpauth" {
+		return "", otpKey{}, fmt.Errorf("%v isn't an otpauth:// URI", uri)
+	}
+	switch u.Host {
+	case "totp":
+	case "hotp":
+		k.HOTP = true
+	default:
+		return "", otpKey{}, fmt.Errorf("unknown otp type %v, must be totp or hotp", u.Host)
+	}
+
+	q := u.Query()
+	k.Secret = strings.ToUpper(q.Get("secret"))
+	k.Issuer = q.Get("issuer")
+	k.Algorithm = strings.ToUpper(q.Get("algorithm"))
+	if k.Algorithm == "" {
+		k.Algorithm = "SHA1"
+	}
+	k.Digits, k.Period = 6, 30
+	if d := q.Get("digits"); d != "" {
+		if k.Digits, err = strconv.Atoi(d); err != nil {
+			return "", otpKey{}, fmt.Errorf("bad digits %v", d)
+		}
+	}
+	if p := q.Get("period"); p != "" && !k.HOTP {
+		if k.Period, err = strconv.Atoi(p); err != nil {
+			return "", otpKey{}, fmt.Errorf("bad period %v", p)
+		}
+	}
+	if k.HOTP {
+		k.Period = 0
+		if c := q.Get("counter"); c != "" {
+			if k.Counter, err = strconv.ParseUint(c, 10, 64); err != nil {
+				return "", otpKey{}, fmt.Errorf("bad counter %v", c)
+			}
+		}
+	}
+
+	// the label is the account optionally prefixed by the issuer
+	name = strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(name, ":"); i >= 0 {
+		if k.Issuer == "" {
+			k.Issuer = strings.TrimSpace(name[:i])
+		}
+		name = strings.TrimSpace(name[i+1:])
+		if k.Issuer != "" {
+			name = k.Issuer + ":" + name
+		}
+	}
+	if name == "" {
+		name = k.Issuer
+	}
+	if name == "" {
+		return "", otpKey{}, fmt.Errorf("%v has no label", uri)
+	}
+	return name, k, k.validate()
+}
+
+// configOTPKeys are the keys within the config, either base32 secrets or
+// otpauth:// URIs
+func configOTPKeys() (map[string]otpKey, error) {
+	keys := make(map[string]otpKey)
+	for name, val := range viper.GetStringMapString("otp") {
+		k := otpKey{Secret: val, Algorithm: "SHA1", Digits: 6, Period: 30}
+		if strings.HasPrefix(val, "otpauth:") {
+			var err error
+			if _, k, err = parseOTPURI(val); err != nil {
+				return nil, fmt.Errorf("bad config otp key %v: %v", name, err)
+			}
+		} else if err := k.validate(); err != nil {
+			return nil, fmt.Errorf("bad config otp key %v: %v", name, err)
+		}
+		keys[name] = k
+	}
+	return keys, nil
+}
+
+// otpStore is the encrypted otp file
+type otpStore struct {
+	file *secretFile
+	keys map[string]otpKey
+}
+
+func loadOTPStore() (*otpStore, error) {
+	file, err := newSecretFile(otpFileFromFlag, ".multitool_otp")
+	if err != nil {
+		return nil, err
+	}
+	s := &otpStore{file: file, keys: make(map[string]otpKey)}
+	if err := file.load(&s.keys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *otpStore) save() error {
+	return s.file.save(s.keys)
+}
+
+func otpCmd(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	configKeys, err := configOTPKeys()
+	if err != nil {
+		return err
+	}
+
+	// keys of the config don't require the passphrase
+	var store *otpStore
+	k, inConfig := configKeys[name]
+	if !inConfig {
+		store, err = loadOTPStore()
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if k, ok = store.keys[name]; !ok {
+			return fmt.Errorf("no otp key named %v", name)
+		}
+	}
+	if k.HOTP && otpCounterFromFlag >= 0 {
+		k.Counter = uint64(otpCounterFromFlag)
+	}
+
+	now := time.Now()
+	code, err := k.code(now)
+	if err != nil {
+		return err
+	}
+
+	// the advanced counter is saved before the code is handed out so that
+	// a failed save never hands out the same code twice
+	if k.HOTP && !inConfig && otpCounterFromFlag < 0 {
+		next := k
+		next.Counter++
+		store.keys[name] = next
+		if err := store.save(); err != nil {
+			return err
+		}
+	}
+	if err := otpIO.write(code); err != nil {
+		return err
+	}
+
+	if !k.HOTP {
+		otpIO.status("otp code for %v added to %v (%v remaining)", name, otpIO.destination(), k.remaining(now))
+		return nil
+	}
+	otpIO.status("otp code for %v added to %v (counter %d)", name, otpIO.destination(), k.Counter)
+	return nil
+}
+
+func otpAddCmd(cmd *cobra.Command, args []string) error {
+	k := otpKey{
+		Issuer:    issuerFromFlag,
+		Secret:    strings.ToUpper(strings.Replace(args[1], " ", "", -1)),
+		HOTP:      hotpFromFlag,
+		Algorithm: strings.ToUpper(algorithmFromFlag),
+		Digits:    otpDigitsFromFlag,
+		Period:    periodFromFlag,
+		Counter:   counterFromFlag,
+	}
+	if k.HOTP {
+		k.Period = 0
+	}
+	if err := k.validate(); err != nil {
+		return err
+	}
+	return addOTPKeys(map[string]otpKey{args[0]: k})
+}
+
+func otpImportCmd(cmd *cobra.Command, args []string) error {
+	uris := args
+	if len(uris) == 0 {
+		text, err := otpImportIO.read()
+		if err != nil {
+			return err
+		}
+		uris = strings.Fields(text)
+	}
+	if len(uris) == 0 {
+		return errors.New("no otpauth:// URIs to import")
+	}
+
+	keys := make(map[string]otpKey)
+	for _, uri := range uris {
+		name, k, err := parseOTPURI(uri)
+		if err != nil {
+			return err
+		}
+		keys[name] = k
+	}
+	return addOTPKeys(keys)
+}
+
+// addOTPKeys adds the keys to the file, replacing any of the same name
+func addOTPKeys(keys map[string]otpKey) error {
+	store, err := loadOTPStore()
+	if err != nil {
+		return err
+	}
+	for name, k := range keys {
+		if _, ok := store.keys[name]; ok {
+			fmt.Printf("replacing otp key %v\n", name)
+		}
+		store.keys[name] = k
+	}
+	if err := store.save(); err != nil {
+		return err
+	}
+	for name, k := range keys {
+		fmt.Printf("added %v key %v\n", k.kind(), name)
+	}
+	return nil
+}
+
+func otpListCmd(cmd *cobra.Command, args []string) error {
+	configKeys, err := configOTPKeys()
+	if err != nil {
+		return err
+	}
+	store, err := loadOTPStore()
+	if err != nil {
+		return err
+	}
+
+	type listed struct {
+		name, source string
+		key          otpKey
+	}
+	var all []listed
+	for name, k := range configKeys {
+		all = append(all, listed{name, "config", k})
+	}
+	for name, k := range store.keys {
+		all = append(all, listed{name, "file", k})
+	}
+	if len(all) == 0 {
+		fmt.Println("no otp keys, add some with \"mt otp add\" or \"mt otp import\"")
+		return nil
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	for _, l := range all {
+		fmt.Printf("%-30s %v %v %d digits", l.name, l.key.kind(), l.key.Algorithm, l.key.Digits)
+		if l.key.Issuer != "" {
+			fmt.Printf(", %v", l.key.Issuer)
+		}
+		fmt.Printf(" (%v)\n", l.source)
+	}
+	return nil
+}
+
+func otpRmCmd(cmd *cobra.Command, args []string) error {
+	store, err := loadOTPStore()
+	if err != nil {
+		return err
+	}
+	if _, ok := store.keys[args[0]]; !ok {
+		return fmt.Errorf("no otp key named %v in %v", args[0], store.file.path)
+	}
+	delete(store.keys, args[0])
+	if err := store.save(); err != nil {
+		return err
+	}
+	fmt.Printf("removed otp key %v\n", args[0])
+	return nil
+}
@@ -1,20 +1,14 @@
 package commands
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"image"
-	"io/ioutil"
-	"os"
 	"path"
-	"strconv"
 	"strings"
 
 	"github.com/jung-kurt/gofpdf"
 	"github.com/spf13/cobra"
-
-	"github.com/pdfcpu/pdfcpu/pkg/api"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 )
 
 // Lock2yamlCmd represents the lock2yaml command
@@ -32,269 +26,251 @@ var (
 	BookPDFCmd = &cobra.Command{
 		Use:   "book [pdf-file]",
 		Short: "first half on right, last half on left",
-		RunE:  bookCmd,
-		Args:  cobra.ExactArgs(1),
+		Long: `Reorder the pages for printing several to each side of a sheet, or with
+--sheets place them onto Letter sheets ready for double sided printing.
+
+Layouts:
+  2-up    two pages per side, cut the printed stack in half and place the
+          right pile under the left
+  4-up    four pages per side, cut into four piles and stack them in order
+  8-up    eight pages per side, likewise
+  saddle  two pages per side, fold the sheets in half and nest them, with
+          --signature-size the sheets are folded into separate signatures of
+          that many sheets for perfect binding`,
+		RunE: bookCmd,
+		Args: cobra.ExactArgs(1),
 	}
 	AltBookPDFCmd = &cobra.Command{
-		Use:   "alt-book [img-files-dir]",
+		Use:   "alt-book [img-files-dir|scanned-pdf]",
 		Short: "first half on right, last half on left",
 		Long: `The directory must be an alphanumerically ordered 
-image files from the first to last page`,
+image files from the first to last page, or a pdf of scanned pages whose
+page images are embedded directly (jpeg scans as is, flate and ccitt scans
+as png, jpeg 2000 and jbig2 scans are not supported), each rotated as its page
+
+The images are placed onto sheets with the same layouts as book, see
+"mt pdf book --help"`,
 		RunE: altBookCmd,
 		Args: cobra.ExactArgs(1),
 	}
+	PrepPDFCmd = &cobra.Command{
+		Use:   "prep [img-files-dir]",
+		Short: "clean up scanned page images for alt-book",
+		Long: `Clean up a directory of scanned page images for alt-book, writing the
+cleaned pages as png files of the same names to a new directory.
+
+Each page is converted to grayscale, dark scanner edges are trimmed, the page
+is deskewed and cropped to its content, optionally thresholded to black and
+white, then all pages are padded to the same size so that the text of each
+page is printed at the same scale.`,
+		RunE: prepCmd,
+		Args: cobra.ExactArgs(1),
+	}
 )
 
 var (
 	xMargin = 0.3
 	yMargin = 0.3
+
+	sheetsFromFlag bool
+	sheetOpts      sheetOptions
 )
 
 func init() {
 	AltBookPDFCmd.PersistentFlags().Float64Var(&xMargin, "xmar", 0.3, "define the x-margin (in inches)")
 	AltBookPDFCmd.PersistentFlags().Float64Var(&yMargin, "ymar", 0.3, "define the y-margin (in inches)")
+	for _, c := range []*cobra.Command{BookPDFCmd, AltBookPDFCmd} {
+		c.PersistentFlags().StringVar(&layoutFromFlag, "layout", "2-up",
+			"page arrangement of each sheet: "+layoutNames())
+		c.PersistentFlags().IntVar(&sigSizeFromFlag, "signature-size", 0,
+			"sheets of each folded signature for perfect binding, 0 for a single saddle stitched signature")
+		c.PersistentFlags().Float64Var(&creepFromFlag, "creep", 0,
+			"shift of each inner sheet of a signature toward the fold, about the paper thickness (in inches)")
+	}
+
+	BookPDFCmd.PersistentFlags().BoolVar(&sheetsFromFlag, "sheets", false,
+		"place the pages onto printable Letter sheets rather than only reordering them")
+	BookPDFCmd.PersistentFlags().Float64Var(&sheetOpts.margin, "margin", 0.25,
+		"margin around each sheet with --sheets (in inches)")
+	BookPDFCmd.PersistentFlags().Float64Var(&sheetOpts.gutter, "gutter", 0.5,
+		"space between the pages of a sheet with --sheets (in inches)")
+	BookPDFCmd.PersistentFlags().BoolVar(&sheetOpts.marks, "marks", true,
+		"draw fold (dashed) and crop marks in the margins with --sheets")
+	PrepPDFCmd.Flags().StringVar(&prepOutFromFlag, "out", "",
+		"directory of the cleaned pages (default [img-files-dir]_prepped)")
+	PrepPDFCmd.Flags().StringVar(&thresholdFromFlag, "threshold", "",
+		"convert to black and white at this gray level (0-255), or auto")
+	PrepPDFCmd.Flags().Float64Var(&maxSkewFromFlag, "max-skew", 5,
+		"largest skew corrected (0-45 degrees), 0 to not deskew")
+	PrepPDFCmd.Flags().BoolVar(&cropFromFlag, "crop", true,
+		"crop the borders around the content of each page")
+	PrepPDFCmd.Flags().BoolVar(&trimFromFlag, "trim-edges", true,
+		"whiten dark scanner edges along the sides of each page")
+	PrepPDFCmd.Flags().BoolVar(&normalizeFromFlag, "normalize", true,
+		"pad all pages to the same size")
+	PrepPDFCmd.Flags().Float64Var(&padFromFlag, "pad", 0.03,
+		"space left around the content when cropping, as a fraction of the page")
 
 	PDFCmd.AddCommand(
 		DoublePDFCmd,
 		BookPDFCmd,
 		AltBookPDFCmd,
+		PrepPDFCmd,
 	)
 	RootCmd.AddCommand(
 		PDFCmd,
 	)
 }
 
-func extract(args []string) (
-	inFile, tempDir string, pgCount int, config *pdfcpu.Configuration, err error) {
-
-	config = pdfcpu.NewDefaultConfiguration()
-
-	inFile = args[0]
-	if path.Ext(inFile) != ".pdf" {
-		return "", "", 0, config, errors.New("not a pdf file")
-	}
-
-	pgCount, err = api.PageCountFile(inFile)
-	if err != nil {
-		return "", "", 0, config, err
-	}
-
-	tempDir, err = ioutil.TempDir("", "_mt_pdf_combine")
-	if err != nil {
-		return "", "", 0, config, err
-	}
-
-	// extract all pdf pages to single pages
-	var allPgs []string
-	for i := 0; i < pgCount; i++ {
-		allPgs = append(allPgs, strconv.Itoa(i+1))
-	}
-	for i := 0; i < pgCount; i++ {
-		outFile := path.Join(tempDir, strconv.Itoa(i+1)+".pdf")
-		rmPgs := make([]string, len(allPgs))
-		copy(rmPgs, allPgs)
-		rmPgs = append(rmPgs[:i], rmPgs[i+1:]...)
-		api.RemovePagesFile(inFile, outFile, rmPgs, config)
-	}
-
-	return inFile, tempDir, pgCount, config, nil
+// outFileName is the input file name with the suffix added
+func outFileName(inFile, suffix string) string {
+	return path.Dir(inFile) + "/" + strings.Split(path.Base(inFile), ".")[0] + suffix + ".pdf"
 }
 
 func doubleCmd(cmd *cobra.Command, args []string) error {
-
-	inFile, tempDir, pgCount, config, err := extract(args)
+	doc, err := readPDF(args[0])
 	if err != nil {
 		return err
 	}
 
 	// double each page
-	var orderedFiles []string
-	for i := 0; i < pgCount; i++ {
-		inFile := path.Join(tempDir, strconv.Itoa(i+1)+".pdf")
-		orderedFiles = append(orderedFiles, inFile, inFile)
+	var order []int
+	for i := range doc.pages {
+		order = append(order, i, i)
+	}
+	if err := doc.setPages(order); err != nil {
+		return err
 	}
 
-	combinedFile := path.Dir(inFile) + "/" + strings.Split(path.Base(inFile), ".")[0] + "_doubled.pdf"
-	api.MergeFile(orderedFiles, combinedFile, config)
+	combinedFile := outFileName(args[0], "_doubled")
+	if err := doc.write(combinedFile); err != nil {
+		return err
+	}
 	fmt.Printf("new file created at: %s\n", combinedFile)
-
-	os.RemoveAll(tempDir)
 	return nil
 }
 
 func bookCmd(cmd *cobra.Command, args []string) error {
-
-	inFile, tempDir, pgCount, config, err := extract(args)
-	if err != nil {
-		return err
-	}
-
-	// add extra padding files
-	modPg := pgCount % 4
-	if modPg != 0 {
-		numInserts := 4 - modPg
-		rectFile := path.Join(tempDir, "rect.pdf")
-		api.InsertPagesFile(inFile, rectFile, []string{"1"}, config)
-
-		var rmPgs []string
-		for i := 1; i < pgCount+1; i++ {
-			rmPgs = append(rmPgs, strconv.Itoa(i+1))
+	if !sheetsFromFlag {
+		if creepFromFlag != 0 {
+			return errors.New("--creep requires --sheets")
 		}
-		for i := 0; i < numInserts; i++ {
-			outFile := path.Join(tempDir, strconv.Itoa(pgCount+1+i)+".pdf")
-			api.RemovePagesFile(rectFile, outFile, rmPgs, config)
+		for _, flag := range []string{"margin", "gutter", "marks"} {
+			if cmd.Flags().Changed(flag) {
+				return fmt.Errorf("--%v requires --sheets", flag)
+			}
 		}
-		pgCount += numInserts
 	}
 
-	midPage := pgCount/2 + 1
-	fmt.Printf("debug modPg: %v\n", modPg)
-
-	var orderedFiles []string
-	for i := 0; midPage+i < pgCount; i += 2 {
-		inFile1 := path.Join(tempDir, strconv.Itoa(i+1)+".pdf")
-		inFile2 := path.Join(tempDir, strconv.Itoa(midPage+i)+".pdf")
-		inFile3 := path.Join(tempDir, strconv.Itoa(midPage+i+1)+".pdf")
-		inFile4 := path.Join(tempDir, strconv.Itoa(i+2)+".pdf")
-		orderedFiles = append(orderedFiles, inFile1, inFile2, inFile3, inFile4)
+	doc, err := readPDF(args[0])
+	if err != nil {
+		return err
 	}
-
-	combinedFile := path.Dir(inFile) + "/" + strings.Split(path.Base(inFile), ".")[0] + "_reordered.pdf"
-	api.MergeFile(orderedFiles, combinedFile, config)
-	fmt.Printf("new file created at: %s\n", combinedFile)
-
-	os.RemoveAll(tempDir)
-	return nil
-}
-
-func altBookCmd(cmd *cobra.Command, args []string) error {
-
-	//inFile := args[0]
-	//if path.Ext(inFile) != ".pdf" {
-	//return errors.New("not a pdf file")
-	//}
-
-	dir := args[0]
-	dirFiles, err := ioutil.ReadDir(args[0])
+	imp, err := newImposition(len(doc.pages))
 	if err != nil {
 		return err
 	}
 
-	var imgPaths []string
-
-	for _, f := range dirFiles {
-		name := f.Name()
-		if strings.HasPrefix(name, ".") {
-			continue
+	if sheetsFromFlag {
+		if err := doc.imposeSheets(imp, sheetOpts); err != nil {
+			return err
 		}
-		if f.IsDir() {
-			continue
+		combinedFile := outFileName(args[0], "_printable_book")
+		if err := doc.write(combinedFile); err != nil {
+			return err
 		}
-		imgPaths = append(imgPaths, path.Join(dir, name))
+		fmt.Printf("new file created at: %s (%d sheets, print double sided)\n",
+			combinedFile, imp.sheets())
+		return nil
 	}
 
-	// get number of pages to create
-	li := len(imgPaths)
-	for ; li%4 != 0; li++ {
-		imgPaths = append(imgPaths, "")
+	if err := doc.setPages(imp.order()); err != nil {
+		return err
 	}
-	pdfPages := li / 2
-
-	pdf := gofpdf.New("L", "in", "Letter", "")
-	pdf.SetMargins(0, 0, 0)
-
-	// create the pdf pages
-	for i := 0; i <= pdfPages; i++ {
-		pdf.AddPage()
+	combinedFile := outFileName(args[0], "_reordered")
+	if err := doc.write(combinedFile); err != nil {
+		return err
 	}
+	fmt.Printf("new file created at: %s (%d sheets, print %d pages per side)\n",
+		combinedFile, imp.sheets(), imp.layout.slots())
+	return nil
+}
 
-	var opt gofpdf.ImageOptions
+func altBookCmd(cmd *cobra.Command, args []string) error {
 
-	// get the im to read height/width ratio
-	// all images should be the same dimentions
-	reader, err := os.Open(imgPaths[0])
-	defer reader.Close()
+	// the pages are the images of a directory or of a scanned pdf
+	src := args[0]
+	outFile := fmt.Sprintf("%v_printable_book.pdf", strings.TrimSuffix(src, "/"))
+	var imgs []bookImage
+	var err error
+	if path.Ext(src) == ".pdf" {
+		imgs, err = pdfImages(src)
+		outFile = outFileName(src, "_printable_book")
+	} else {
+		imgs, err = dirImages(src)
+	}
 	if err != nil {
 		return err
 	}
-	im, _, err := image.DecodeConfig(reader)
+
+	imp, err := newImposition(len(imgs))
 	if err != nil {
 		return err
 	}
 
-	// determine positions and scales
-	w, h := 0.0, 8.5-2*yMargin // zero means autoscale here
-	yPosition := yMargin
-	scaledWidth := h * float64(im.Width) / float64(im.Height)
-	xPositionLeft := (11.0/2.0 - scaledWidth) / 2
-	if xPositionLeft < 0 {
-		xPositionLeft = xMargin
-		w, h = 11.0/2-2*xMargin, 0.0 // zero means autoscale here
-		scaledHeight := w * float64(im.Height) / float64(im.Width)
-		yPosition = (8.5 - scaledHeight) / 2
+	orientation, sheetW, sheetH := "P", 8.5, 11.0
+	if imp.layout.landscape {
+		orientation, sheetW, sheetH = "L", 11.0, 8.5
 	}
-	xPositionRight := 11.0/2.0 + xPositionLeft
-
-	// process a whole sheet front and back at once
-	imgIndex := 0
-	for i := 0; i < pdfPages; i += 2 {
-
-		// front left (pg1)
-		pdf.SetPage(i + 1)
-		if imgIndex >= len(imgPaths) {
-			continue
-		}
-		imgPath := imgPaths[imgIndex]
-		if imgPath != "" {
-			pdf.ImageOptions(imgPath, xPositionLeft, yPosition, w, h, false, opt, 0, "")
-		}
-		imgIndex++
+	pdf := gofpdf.New(orientation, "in", "Letter", "")
+	pdf.SetMargins(0, 0, 0)
 
-		// back right (pg2)
-		pdf.SetPage(i + 2)
-		if imgIndex >= len(imgPaths) {
-			continue
+	// images of a pdf are registered from memory
+	for _, img := range imgs {
+		if img.data != nil {
+			opt := gofpdf.ImageOptions{ImageType: img.imageType}
+			pdf.RegisterImageOptionsReader(img.name, opt, bytes.NewReader(img.data))
 		}
-		imgPath = imgPaths[imgIndex]
-		if imgPath != "" {
-			pdf.ImageOptions(imgPath, xPositionRight, yPosition, w, h, false, opt, 0, "")
-		}
-		imgIndex++
+	}
+	if err := pdf.Error(); err != nil {
+		return err
 	}
 
-	for i := 0; i < pdfPages; i += 2 {
-
-		// front right (pgMID)
-		pdf.SetPage(i + 1)
-		if imgIndex >= len(imgPaths) {
-			continue
-		}
-		imgPath := imgPaths[imgIndex]
-		if imgPath != "" {
-			pdf.ImageOptions(imgPath, xPositionRight, yPosition, w, h, false, opt, 0, "")
-		}
-		imgIndex++
+	var opt gofpdf.ImageOptions
+	cellW := sheetW / float64(imp.layout.cols)
+	cellH := sheetH / float64(imp.layout.rows)
 
-		// back left (pgMID+1)
-		pdf.SetPage(i + 2)
-		if imgIndex >= len(imgPaths) {
-			continue
-		}
-		imgPath = imgPaths[imgIndex]
-		if imgPath != "" {
-			pdf.ImageOptions(imgPath, xPositionLeft, yPosition, w, h, false, opt, 0, "")
+	// each side of each sheet is a page of the pdf
+	for _, side := range imp.sides {
+		pdf.AddPage()
+		for slot, p := range side {
+			if p.page < 0 {
+				continue
+			}
+			img := imgs[p.page]
+
+			// determine the position and scale within the slot
+			w, h := 0.0, cellH-2*yMargin // zero means autoscale here
+			scaledWidth := h * float64(img.width) / float64(img.height)
+			xOffset, yOffset := (cellW-scaledWidth)/2, yMargin
+			if xOffset < 0 {
+				xOffset = xMargin
+				w, h = cellW-2*xMargin, 0.0 // zero means autoscale here
+				scaledHeight := w * float64(img.height) / float64(img.width)
+				yOffset = (cellH - scaledHeight) / 2
+			}
+
+			col, row := imp.layout.slotPos(slot)
+			x := float64(col)*cellW + xOffset + p.shift
+			y := float64(row)*cellH + yOffset
+			pdf.ImageOptions(img.name, x, y, w, h, false, opt, 0, "")
 		}
-		imgIndex++
 	}
 
-	err = pdf.OutputFileAndClose(fmt.Sprintf("%v_printable_book.pdf", strings.TrimSuffix(dir, "/")))
+	err = pdf.OutputFileAndClose(outFile)
 	if err != nil {
 		return err
 	}
-
-	// TODO
-	//// delete the working folder
-	//os.RemoveAll(dir)
-
+	fmt.Printf("new file created at: %s\n", outFile)
 	return nil
 }
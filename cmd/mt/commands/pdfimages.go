@@ -0,0 +1,612 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"golang.org/x/image/ccitt"
+)
+
+// bookImage is an image of a page for alt-book, either a file or the image
+// of a scanned pdf page held in memory
+type bookImage struct {
+	name          string
+	imageType     string // of data, ex. "JPG" or "PNG"
+	data          []byte
+	width, height int
+}
+
+// dirImages are the images of the directory in alphanumeric order
+func dirImages(dir string) ([]bookImage, error) {
+	dirFiles, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var imgs []bookImage
+	for _, f := range dirFiles {
+		name := f.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if f.IsDir() {
+			continue
+		}
+		imgPath := path.Join(dir, name)
+		reader, err := os.Open(imgPath)
+		if err != nil {
+			return nil, err
+		}
+		im, _, err := image.DecodeConfig(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", imgPath, err)
+		}
+		imgs = append(imgs, bookImage{name: imgPath, width: im.Width, height: im.Height})
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("no images in %v", dir)
+	}
+	return imgs, nil
+}
+
+// pdfImages are the images of each page of a scanned pdf, the largest image
+// of each page is taken as its scan and turned by the page rotation
+func pdfImages(inFile string) ([]bookImage, error) {
+	doc, err := readPDF(inFile)
+	if err != nil {
+		return nil, err
+	}
+	var imgs []bookImage
+	for i, page := range doc.pages {
+		sd, err := doc.pageImage(page)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		img, err := doc.decodePDFImage(sd)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		if obj, ok := page["Rotate"]; ok {
+			r, err := doc.pdfNumber(obj)
+			if err != nil {
+				return nil, fmt.Errorf("page %d: %v", i+1, err)
+			}
+			if img, err = img.rotate((int(r)%360 + 360) % 360); err != nil {
+				return nil, fmt.Errorf("page %d: %v", i+1, err)
+			}
+		}
+		img.name = fmt.Sprintf("page-%d", i+1)
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+// pageImage is the largest image xobject of the page
+func (doc *pdfDoc) pageImage(page pdfcpu.Dict) (pdfcpu.StreamDict, error) {
+	var best pdfcpu.StreamDict
+	bestArea := 0.0
+	res, err := doc.dict(page["Resources"])
+	if err != nil {
+		return best, err
+	}
+	xobjects, err := doc.dict(res["XObject"])
+	if err != nil {
+		return best, err
+	}
+	for _, obj := range xobjects {
+		o, err := doc.ctx.Dereference(obj)
+		if err != nil {
+			return best, err
+		}
+		sd, ok := o.(pdfcpu.StreamDict)
+		if !ok || sd.Dict["Subtype"] != pdfcpu.Name("Image") {
+			continue
+		}
+		w, err := doc.pdfNumber(sd.Dict["Width"])
+		if err != nil {
+			return best, err
+		}
+		h, err := doc.pdfNumber(sd.Dict["Height"])
+		if err != nil {
+			return best, err
+		}
+		if w*h > bestArea {
+			best, bestArea = sd, w*h
+		}
+	}
+	if bestArea == 0 {
+		return best, errors.New("no image, alt-book takes scanned pdfs (see \"mt pdf book --sheets\" for others)")
+	}
+	return best, nil
+}
+
+// dict is the dictionary of the object, empty when missing
+func (doc *pdfDoc) dict(obj pdfcpu.Object) (pdfcpu.Dict, error) {
+	if obj == nil {
+		return pdfcpu.Dict{}, nil
+	}
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := o.(pdfcpu.Dict)
+	if !ok {
+		return nil, fmt.Errorf("%v isn't a dictionary", o)
+	}
+	return d, nil
+}
+
+// filters are the names of the filters of the stream
+func (doc *pdfDoc) filters(sd pdfcpu.StreamDict) ([]string, error) {
+	obj, ok := sd.Dict["Filter"]
+	if !ok {
+		return nil, nil
+	}
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+	switch f := o.(type) {
+	case pdfcpu.Name:
+		return []string{string(f)}, nil
+	case pdfcpu.Array:
+		var names []string
+		for _, n := range f {
+			if name, ok := n.(pdfcpu.Name); ok {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+	return nil, errors.New("bad image filter")
+}
+
+// colorSpace is the number of components of the image color space, and the
+// palette of an indexed color space
+func (doc *pdfDoc) colorSpace(sd pdfcpu.StreamDict) (int, color.Palette, error) {
+	if mask, ok := sd.Dict["ImageMask"]; ok && mask == pdfcpu.Boolean(true) {
+		return 1, nil, nil
+	}
+	return doc.colorSpaceOf(sd.Dict["ColorSpace"])
+}
+
+func (doc *pdfDoc) colorSpaceOf(obj pdfcpu.Object) (int, color.Palette, error) {
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch cs := o.(type) {
+	case pdfcpu.Name:
+		switch cs {
+		case "DeviceGray", "CalGray":
+			return 1, nil, nil
+		case "DeviceRGB", "CalRGB":
+			return 3, nil, nil
+		case "DeviceCMYK":
+			return 4, nil, nil
+		}
+	case pdfcpu.Array:
+		if len(cs) == 2 && cs[0] == pdfcpu.Name("ICCBased") {
+			o, err := doc.ctx.Dereference(cs[1])
+			if err != nil {
+				return 0, nil, err
+			}
+			if icc, ok := o.(pdfcpu.StreamDict); ok {
+				n, err := doc.pdfNumber(icc.Dict["N"])
+				return int(n), nil, err
+			}
+		}
+		if len(cs) == 4 && (cs[0] == pdfcpu.Name("Indexed") || cs[0] == pdfcpu.Name("I")) {
+			palette, err := doc.indexedPalette(cs)
+			return 1, palette, err
+		}
+	}
+	return 0, nil, fmt.Errorf("unsupported image color space %v", o)
+}
+
+// indexedPalette is the palette of an indexed color space, [/Indexed base
+// hival lookup] where the lookup holds the base components of each color
+func (doc *pdfDoc) indexedPalette(cs pdfcpu.Array) (color.Palette, error) {
+	comps, palette, err := doc.colorSpaceOf(cs[1])
+	if err != nil {
+		return nil, err
+	}
+	if palette != nil {
+		return nil, errors.New("bad indexed color space of an indexed base")
+	}
+	hival, err := doc.pdfNumber(cs[2])
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := doc.pdfBytes(cs[3])
+	if err != nil {
+		return nil, err
+	}
+	n := int(hival) + 1
+	if n < 1 || n > 256 || len(lookup) < n*comps {
+		return nil, errors.New("bad indexed color space lookup")
+	}
+
+	palette = make(color.Palette, n)
+	for i := range palette {
+		c := lookup[i*comps:]
+		switch comps {
+		case 1:
+			palette[i] = color.Gray{c[0]}
+		case 3:
+			palette[i] = color.RGBA{c[0], c[1], c[2], 255}
+		case 4:
+			palette[i] = color.CMYK{c[0], c[1], c[2], c[3]}
+		default:
+			return nil, fmt.Errorf("unsupported indexed color space of %d components", comps)
+		}
+	}
+	return palette, nil
+}
+
+// pdfBytes is the content of a string or stream
+func (doc *pdfDoc) pdfBytes(obj pdfcpu.Object) ([]byte, error) {
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+	switch v := o.(type) {
+	case pdfcpu.StringLiteral:
+		return unescapePDFString(string(v)), nil
+	case pdfcpu.HexLiteral:
+		h := string(v)
+		if len(h)%2 == 1 {
+			h += "0"
+		}
+		return hex.DecodeString(h)
+	case pdfcpu.StreamDict:
+		if err := v.Decode(); err != nil {
+			return nil, err
+		}
+		return v.Content, nil
+	}
+	return nil, fmt.Errorf("%v isn't a string", o)
+}
+
+// unescapePDFString resolves the escape sequences of a literal string
+func unescapePDFString(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r', '\n':
+			// a line continuation, "\r\n" is a single end of line
+			if c == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		default:
+			if c < '0' || c > '7' {
+				out = append(out, c)
+				continue
+			}
+			// up to three octal digits
+			v := 0
+			for n := 0; n < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; n++ {
+				v = v*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+			out = append(out, byte(v))
+		}
+	}
+	return out
+}
+
+// decodePDFImage returns the image as a jpeg, which is embedded as is, or
+// otherwise decodes its samples to a png
+func (doc *pdfDoc) decodePDFImage(sd pdfcpu.StreamDict) (bookImage, error) {
+	w, err := doc.pdfNumber(sd.Dict["Width"])
+	if err != nil {
+		return bookImage{}, err
+	}
+	h, err := doc.pdfNumber(sd.Dict["Height"])
+	if err != nil {
+		return bookImage{}, err
+	}
+	img := bookImage{width: int(w), height: int(h)}
+
+	filters, err := doc.filters(sd)
+	if err != nil {
+		return img, err
+	}
+	for _, f := range filters {
+		switch f {
+		case "DCTDecode":
+			if len(filters) != 1 {
+				return img, errors.New("unsupported image filters " + strings.Join(filters, ", "))
+			}
+			img.imageType, img.data = "JPG", sd.Raw
+			return img, nil
+		case "CCITTFaxDecode":
+			if len(filters) != 1 {
+				return img, errors.New("unsupported image filters " + strings.Join(filters, ", "))
+			}
+			return doc.decodeCCITT(sd, img)
+		case "JPXDecode", "JBIG2Decode":
+			return img, fmt.Errorf("unsupported image filter %v, only jpeg, flate and ccitt scans are "+
+				"supported, rasterize the pdf first (see the README)", f)
+		}
+	}
+
+	if err := sd.Decode(); err != nil {
+		return img, err
+	}
+	comps, palette, err := doc.colorSpace(sd)
+	if err != nil {
+		return img, err
+	}
+	bpc := 8.0
+	if obj, ok := sd.Dict["BitsPerComponent"]; ok {
+		if bpc, err = doc.pdfNumber(obj); err != nil {
+			return img, err
+		}
+	}
+	if mask, ok := sd.Dict["ImageMask"]; ok && mask == pdfcpu.Boolean(true) {
+		bpc = 1
+	}
+
+	decoded, err := samplesImage(sd.Content, img.width, img.height, comps, int(bpc), palette, doc.inverted(sd))
+	if err != nil {
+		return img, err
+	}
+	return img.withPNG(decoded)
+}
+
+// inverted is whether the decode array of a gray image is [1 0]
+func (doc *pdfDoc) inverted(sd pdfcpu.StreamDict) bool {
+	o, err := doc.ctx.Dereference(sd.Dict["Decode"])
+	if err != nil {
+		return false
+	}
+	arr, ok := o.(pdfcpu.Array)
+	if !ok || len(arr) != 2 {
+		return false
+	}
+	first, _ := doc.pdfNumber(arr[0])
+	return first == 1
+}
+
+// decodeParms are the parameters of the stream's first filter
+func (doc *pdfDoc) decodeParms(sd pdfcpu.StreamDict) (pdfcpu.Dict, error) {
+	o, err := doc.ctx.Dereference(sd.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+	if arr, ok := o.(pdfcpu.Array); ok {
+		if len(arr) == 0 {
+			return pdfcpu.Dict{}, nil
+		}
+		o = arr[0]
+	}
+	return doc.dict(o)
+}
+
+// decodeCCITT decodes a fax encoded (group 3 or 4) black and white image,
+// the encoding of most black and white scans
+func (doc *pdfDoc) decodeCCITT(sd pdfcpu.StreamDict, img bookImage) (bookImage, error) {
+	parms, err := doc.decodeParms(sd)
+	if err != nil {
+		return img, err
+	}
+	param := func(name string, def float64) (float64, error) {
+		if obj, ok := parms[name]; ok {
+			return doc.pdfNumber(obj)
+		}
+		return def, nil
+	}
+	flag := func(name string) bool {
+		o, err := doc.ctx.Dereference(parms[name])
+		return err == nil && o == pdfcpu.Boolean(true)
+	}
+
+	k, err := param("K", 0)
+	if err != nil {
+		return img, err
+	}
+	sf := ccitt.Group4
+	switch {
+	case k == 0:
+		sf = ccitt.Group3
+	case k > 0:
+		return img, errors.New("unsupported mixed 2d group 3 fax image, rasterize the pdf first (see the README)")
+	}
+	cols, err := param("Columns", 1728)
+	if err != nil {
+		return img, err
+	}
+	if int(cols) != img.width {
+		return img, fmt.Errorf("fax image of %v columns but a width of %d", cols, img.width)
+	}
+
+	opts := &ccitt.Options{Align: flag("EncodedByteAlign"), Invert: flag("BlackIs1")}
+	g, err := decodeFax(sd.Raw, img.width, img.height, sf, opts)
+	if err != nil {
+		return img, err
+	}
+	if doc.inverted(sd) {
+		for i, v := range g.Pix {
+			g.Pix[i] = 255 - v
+		}
+	}
+	return img.withPNG(g)
+}
+
+// decodeFax decodes the fax encoded data to a grayscale image, 0 is black
+// unless inverted
+func decodeFax(data []byte, w, h int, sf ccitt.SubFormat, opts *ccitt.Options) (*image.Gray, error) {
+	g := image.NewGray(image.Rect(0, 0, w, h))
+	if err := ccitt.DecodeIntoGray(g, bytes.NewReader(data), ccitt.MSB, sf, opts); err != nil {
+		return nil, fmt.Errorf("fax image: %v", err)
+	}
+	return g, nil
+}
+
+// withPNG sets the image data to the png of the image
+func (img bookImage) withPNG(im image.Image) (bookImage, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, im); err != nil {
+		return img, err
+	}
+	b := im.Bounds()
+	img.imageType, img.data = "PNG", buf.Bytes()
+	img.width, img.height = b.Dx(), b.Dy()
+	return img, nil
+}
+
+// rotate turns the image clockwise by the degrees, a multiple of 90
+func (img bookImage) rotate(deg int) (bookImage, error) {
+	if deg == 0 {
+		return img, nil
+	}
+	if deg%90 != 0 {
+		return img, fmt.Errorf("bad page rotation %d", deg)
+	}
+	im, _, err := image.Decode(bytes.NewReader(img.data))
+	if err != nil {
+		return img, err
+	}
+	return img.withPNG(rotateImage(im, deg))
+}
+
+// rotateImage turns the image clockwise by 90, 180 or 270 degrees, gray
+// images are kept gray
+func rotateImage(im image.Image, deg int) image.Image {
+	b := im.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rect := image.Rect(0, 0, w, h)
+	if deg != 180 {
+		rect = image.Rect(0, 0, h, w)
+	}
+
+	// the source pixel of each rotated pixel
+	src := func(x, y int) (int, int) {
+		switch deg {
+		case 90:
+			return y, h - 1 - x
+		case 180:
+			return w - 1 - x, h - 1 - y
+		}
+		return w - 1 - y, x
+	}
+
+	if g, ok := im.(*image.Gray); ok {
+		out := image.NewGray(rect)
+		for y := 0; y < rect.Dy(); y++ {
+			for x := 0; x < rect.Dx(); x++ {
+				sx, sy := src(x, y)
+				out.Pix[y*out.Stride+x] = g.Pix[sy*g.Stride+sx]
+			}
+		}
+		return out
+	}
+	out := image.NewRGBA(rect)
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			sx, sy := src(x, y)
+			out.Set(x, y, im.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// samplesImage builds an image from the raw samples of a pdf image, rows
+// are padded to whole bytes. 16 bit samples are reduced to 8 bits, and the
+// samples of an indexed image are indices into the palette.
+func samplesImage(samples []byte, w, h, comps, bpc int, palette color.Palette, invert bool) (image.Image, error) {
+	rowLen := (w*comps*bpc + 7) / 8
+	if len(samples) < rowLen*h {
+		return nil, errors.New("image data is shorter than its size")
+	}
+	if bpc == 16 && palette == nil {
+		// big endian, the high byte of each sample is kept
+		reduced := make([]byte, w*comps*h)
+		for i := range reduced {
+			reduced[i] = samples[2*i]
+		}
+		samples, bpc, rowLen = reduced, 8, w*comps
+	}
+	rect := image.Rect(0, 0, w, h)
+
+	// the value of each packed sample of a single component row
+	sample := func(row []byte, x int) int {
+		bit := x * bpc
+		return int(row[bit/8]>>uint(8-bpc-bit%8)) & (1<<uint(bpc) - 1)
+	}
+	packed := bpc == 1 || bpc == 2 || bpc == 4 || bpc == 8
+
+	switch {
+	case comps == 1 && packed && palette != nil:
+		im := image.NewPaletted(rect, palette)
+		for y := 0; y < h; y++ {
+			row := samples[y*rowLen:]
+			for x := 0; x < w; x++ {
+				i := sample(row, x)
+				if i >= len(palette) {
+					i = len(palette) - 1
+				}
+				im.Pix[y*im.Stride+x] = uint8(i)
+			}
+		}
+		return im, nil
+	case comps == 1 && packed:
+		im := image.NewGray(rect)
+		maxV := 1<<uint(bpc) - 1
+		for y := 0; y < h; y++ {
+			row := samples[y*rowLen:]
+			for x := 0; x < w; x++ {
+				v := sample(row, x)
+				if invert {
+					v = maxV - v
+				}
+				im.SetGray(x, y, color.Gray{uint8(v * 255 / maxV)})
+			}
+		}
+		return im, nil
+	case comps == 3 && bpc == 8:
+		im := image.NewRGBA(rect)
+		for y := 0; y < h; y++ {
+			row := samples[y*rowLen:]
+			for x := 0; x < w; x++ {
+				im.Set(x, y, color.RGBA{row[3*x], row[3*x+1], row[3*x+2], 255})
+			}
+		}
+		return im, nil
+	case comps == 4 && bpc == 8:
+		im := image.NewCMYK(rect)
+		for y := 0; y < h; y++ {
+			copy(im.Pix[y*im.Stride:], samples[y*rowLen:y*rowLen+4*w])
+		}
+		return im, nil
+	}
+	return nil, fmt.Errorf("unsupported image of %d components of %d bits", comps, bpc)
+}
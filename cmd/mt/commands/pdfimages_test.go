@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/ccitt"
+)
+
+func TestSamplesImage(t *testing.T) {
+	palette := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	cases := []struct {
+		name       string
+		samples    []byte
+		w, h       int
+		comps, bpc int
+		palette    color.Palette
+		invert     bool
+		expected   []color.Color // row by row, nil when an error is expected
+	}{
+		{"gray 1 bit, padded rows", []byte{0xA0, 0x40}, 3, 2, 1, 1, nil, false,
+			[]color.Color{color.Gray{255}, color.Gray{0}, color.Gray{255}, color.Gray{0}, color.Gray{255}, color.Gray{0}}},
+		{"gray 1 bit inverted", []byte{0x80}, 2, 1, 1, 1, nil, true,
+			[]color.Color{color.Gray{0}, color.Gray{255}}},
+		{"gray 4 bit", []byte{0x0F}, 2, 1, 1, 4, nil, false,
+			[]color.Color{color.Gray{0}, color.Gray{255}}},
+		{"gray 16 bit", []byte{0x12, 0x34, 0xFF, 0x00}, 2, 1, 1, 16, nil, false,
+			[]color.Color{color.Gray{0x12}, color.Gray{0xFF}}},
+		{"rgb 8 bit", []byte{1, 2, 3, 4, 5, 6}, 2, 1, 3, 8, nil, false,
+			[]color.Color{color.RGBA{1, 2, 3, 255}, color.RGBA{4, 5, 6, 255}}},
+		{"rgb 16 bit", []byte{1, 0, 2, 0, 3, 0}, 1, 1, 3, 16, nil, false,
+			[]color.Color{color.RGBA{1, 2, 3, 255}}},
+		{"cmyk 8 bit", []byte{1, 2, 3, 4}, 1, 1, 4, 8, nil, false,
+			[]color.Color{color.CMYK{1, 2, 3, 4}}},
+		{"indexed 1 bit", []byte{0x40}, 2, 1, 1, 1, palette, false,
+			[]color.Color{palette[0], palette[1]}},
+		{"indexed 8 bit", []byte{1, 0}, 2, 1, 1, 8, palette, false,
+			[]color.Color{palette[1], palette[0]}},
+		{"short data", []byte{1, 2}, 2, 2, 1, 8, nil, false, nil},
+		{"unsupported bits", []byte{0, 0, 0}, 1, 1, 3, 4, nil, false, nil},
+	}
+	for _, c := range cases {
+		im, err := samplesImage(c.samples, c.w, c.h, c.comps, c.bpc, c.palette, c.invert)
+		if c.expected == nil {
+			if err == nil {
+				t.Errorf("%v: expected an error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+			continue
+		}
+		for i, e := range c.expected {
+			x, y := i%c.w, i/c.w
+			r1, g1, b1, a1 := im.At(x, y).RGBA()
+			r2, g2, b2, a2 := e.RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				t.Errorf("%v: pixel (%d, %d) is %v, expected %v", c.name, x, y, im.At(x, y), e)
+			}
+		}
+	}
+}
+
+func TestRotateImage(t *testing.T) {
+	// 3 wide and 2 high, numbered left to right from the top
+	g := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(g.Pix, []byte{1, 2, 3, 4, 5, 6})
+	cases := map[int]struct {
+		w, h int
+		pix  []byte
+	}{
+		90:  {2, 3, []byte{4, 1, 5, 2, 6, 3}},
+		180: {3, 2, []byte{6, 5, 4, 3, 2, 1}},
+		270: {2, 3, []byte{3, 6, 2, 5, 1, 4}},
+	}
+	for deg, c := range cases {
+		out := rotateImage(g, deg).(*image.Gray)
+		if out.Rect.Dx() != c.w || out.Rect.Dy() != c.h || string(out.Pix) != string(c.pix) {
+			t.Errorf("%d: got %dx%d %v, expected %dx%d %v", deg, out.Rect.Dx(), out.Rect.Dy(), out.Pix, c.w, c.h, c.pix)
+		}
+	}
+}
+
+func TestDecodeFax(t *testing.T) {
+	// group 4 encoded 10x2 image, both rows 2 white, 4 black then 4 white,
+	// followed by the end of block code
+	data := []byte{0x2E, 0xFC, 0x00, 0x40, 0x04}
+	expected := []byte{255, 255, 0, 0, 0, 0, 255, 255, 255, 255}
+	expected = append(expected, expected...)
+
+	g, err := decodeFax(data, 10, 2, ccitt.Group4, &ccitt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Rect.Dx() != 10 || g.Rect.Dy() != 2 || string(g.Pix) != string(expected) {
+		t.Errorf("got %dx%d %v, expected 10x2 %v", g.Rect.Dx(), g.Rect.Dy(), g.Pix, expected)
+	}
+
+	if _, err := decodeFax(data[:1], 10, 2, ccitt.Group4, &ccitt.Options{}); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
+
+func TestUnescapePDFString(t *testing.T) {
+	cases := map[string]string{
+		`plain`:         "plain",
+		`a\(b\)c\\`:     `a(b)c\`,
+		`\n\t`:          "\n\t",
+		`\101\0\377`:    "A\x00\xff",
+		`\0053`:         "\x053",
+		"split\\\nline": "splitline",
+	}
+	for in, expected := range cases {
+		if got := string(unescapePDFString(in)); got != expected {
+			t.Errorf("%q: got %q, expected %q", in, got, expected)
+		}
+	}
+}
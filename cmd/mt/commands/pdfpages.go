@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// page operations rebuild the page tree of a single pdfcpu context from
+// references to the existing pages, the content of the pages is never
+// copied so reordering is linear in the page count
+
+// attributes which pages inherit from their ancestors in the page tree
+var inheritedPageAttrs = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// pdfDoc is a pdf along with its pages in order, the pages are detached
+// from the page tree with their inherited attributes resolved
+type pdfDoc struct {
+	ctx   *pdfcpu.Context
+	pages []pdfcpu.Dict
+}
+
+// readPDF reads and validates the pdf file
+func readPDF(inFile string) (*pdfDoc, error) {
+	if path.Ext(inFile) != ".pdf" {
+		return nil, errors.New("not a pdf file")
+	}
+	ctx, err := api.ReadContextFile(inFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		return nil, err
+	}
+
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	doc := &pdfDoc{ctx: ctx}
+	if err := doc.collectPages(catalog["Pages"], pdfcpu.Dict{}); err != nil {
+		return nil, err
+	}
+	if len(doc.pages) == 0 {
+		return nil, fmt.Errorf("no pages in %v", inFile)
+	}
+	return doc, nil
+}
+
+// collectPages walks the page tree from the node, depth first
+func (doc *pdfDoc) collectPages(obj pdfcpu.Object, inherited pdfcpu.Dict) error {
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return err
+	}
+	node, ok := o.(pdfcpu.Dict)
+	if !ok {
+		return errors.New("corrupt page tree, node isn't a dictionary")
+	}
+
+	attrs := pdfcpu.Dict{}
+	for k, v := range inherited {
+		attrs[k] = v
+	}
+	for _, k := range inheritedPageAttrs {
+		if v, ok := node[k]; ok {
+			attrs[k] = v
+		}
+	}
+
+	kidsObj, ok := node["Kids"]
+	if !ok {
+		page := pdfcpu.Dict{}
+		for k, v := range attrs {
+			page[k] = v
+		}
+		for k, v := range node {
+			page[k] = v
+		}
+		delete(page, "Parent")
+		doc.pages = append(doc.pages, page)
+		return nil
+	}
+
+	o, err = doc.ctx.Dereference(kidsObj)
+	if err != nil {
+		return err
+	}
+	kids, ok := o.(pdfcpu.Array)
+	if !ok {
+		return errors.New("corrupt page tree, kids aren't an array")
+	}
+	for _, kid := range kids {
+		if err := doc.collectPages(kid, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blankPage is an empty page the size of the page
+func blankPage(like pdfcpu.Dict) pdfcpu.Dict {
+	page := pdfcpu.Dict{
+		"Type":      pdfcpu.Name("Page"),
+		"Resources": pdfcpu.Dict{},
+	}
+	for _, k := range []string{"MediaBox", "CropBox", "Rotate"} {
+		if v, ok := like[k]; ok {
+			page[k] = v
+		}
+	}
+	return page
+}
+
+// setPages replaces the page tree with the pages in the order, pages may
+// repeat and -1 is a blank page
+func (doc *pdfDoc) setPages(order []int) error {
+
+	// each placement of a page is its own page object sharing the contents
+	// and resources of the original
+	var pages []pdfcpu.Dict
+	for _, i := range order {
+		switch {
+		case i < 0:
+			pages = append(pages, blankPage(doc.pages[0]))
+		case i < len(doc.pages):
+			page := pdfcpu.Dict{}
+			for k, v := range doc.pages[i] {
+				page[k] = v
+			}
+			pages = append(pages, page)
+		default:
+			return fmt.Errorf("no page %d", i+1)
+		}
+	}
+	return doc.replacePages(pages)
+}
+
+// replacePages replaces the page tree with a single node of the pages
+func (doc *pdfDoc) replacePages(pages []pdfcpu.Dict) error {
+	xref := doc.ctx.XRefTable
+	root := pdfcpu.Dict{"Type": pdfcpu.Name("Pages")}
+	rootRef, err := xref.IndRefForNewObject(root)
+	if err != nil {
+		return err
+	}
+
+	var kids pdfcpu.Array
+	for _, page := range pages {
+		page["Parent"] = *rootRef
+		ref, err := xref.IndRefForNewObject(page)
+		if err != nil {
+			return err
+		}
+		kids = append(kids, *ref)
+	}
+	root["Kids"] = kids
+	root["Count"] = pdfcpu.Integer(len(kids))
+
+	catalog, err := xref.Catalog()
+	if err != nil {
+		return err
+	}
+	catalog["Pages"] = *rootRef
+	xref.PageCount = len(kids)
+	return nil
+}
+
+// write optimizes and writes the pdf
+func (doc *pdfDoc) write(outFile string) error {
+	if err := api.OptimizeContext(doc.ctx); err != nil {
+		return err
+	}
+	return api.WriteContextFile(doc.ctx, outFile)
+}
@@ -0,0 +1,404 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // decode jpeg scans
+	"image/png"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// scanned page cleanup flags
+var (
+	prepOutFromFlag   string
+	thresholdFromFlag string
+	maxSkewFromFlag   float64
+	cropFromFlag      bool
+	trimFromFlag      bool
+	normalizeFromFlag bool
+	padFromFlag       float64
+)
+
+// toGray converts the image to grayscale
+func toGray(im image.Image) *image.Gray {
+	if g, ok := im.(*image.Gray); ok {
+		return g
+	}
+	b := im.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(g, g.Bounds(), im, b.Min, draw.Src)
+	return g
+}
+
+// otsu is the threshold best separating the dark and light pixels, the
+// lightest dark level plus one
+func otsu(g *image.Gray) uint8 {
+	var hist [256]int
+	for _, v := range g.Pix {
+		hist[v]++
+	}
+	total := len(g.Pix)
+	sum := 0.0
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+
+	best, bestVar := 0, -1.0
+	sumDark, dark := 0.0, 0
+	for t := 0; t < 256; t++ {
+		dark += hist[t]
+		if dark == 0 {
+			continue
+		}
+		light := total - dark
+		if light == 0 {
+			break
+		}
+		sumDark += float64(t * hist[t])
+		meanDark := sumDark / float64(dark)
+		meanLight := (sum - sumDark) / float64(light)
+		v := float64(dark) * float64(light) * (meanDark - meanLight) * (meanDark - meanLight)
+		if v > bestVar {
+			best, bestVar = t+1, v
+		}
+	}
+	return uint8(best)
+}
+
+// trimDarkEdges whitens the dark bands which scanners leave along the sides
+// of a page, up to a sixth of the page from each side
+func trimDarkEdges(g *image.Gray) {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	colMean := func(x int) int {
+		sum := 0
+		for y := 0; y < h; y++ {
+			sum += int(g.Pix[y*g.Stride+x])
+		}
+		return sum / h
+	}
+	rowMean := func(y int) int {
+		sum := 0
+		for x := 0; x < w; x++ {
+			sum += int(g.Pix[y*g.Stride+x])
+		}
+		return sum / w
+	}
+	whiten := func(x0, y0, x1, y1 int) {
+		draw.Draw(g, image.Rect(x0, y0, x1, y1), image.White, image.Point{}, draw.Src)
+	}
+
+	left := 0
+	for left < w/6 && colMean(left) < 128 {
+		left++
+	}
+	right := w
+	for right > w-w/6 && colMean(right-1) < 128 {
+		right--
+	}
+	top := 0
+	for top < h/6 && rowMean(top) < 128 {
+		top++
+	}
+	bottom := h
+	for bottom > h-h/6 && rowMean(bottom-1) < 128 {
+		bottom--
+	}
+	whiten(0, 0, left, h)
+	whiten(right, 0, w, h)
+	whiten(0, 0, w, top)
+	whiten(0, bottom, w, h)
+}
+
+// skewAngle is the angle (in radians, clockwise) of the lines of text. The
+// dark pixels are projected across each candidate angle, lines of text
+// aligned with the angle give the sharpest peaks.
+func skewAngle(g *image.Gray, thresh uint8, maxDeg float64) float64 {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	// sampled down to about 800 pixels across for speed
+	step := w / 800
+	if h > w {
+		step = h / 800
+	}
+	if step < 1 {
+		step = 1
+	}
+
+	var xs, ys []float64
+	for y := 0; y < h; y += step {
+		for x := 0; x < w; x += step {
+			if g.Pix[y*g.Stride+x] < thresh {
+				xs = append(xs, float64(x))
+				ys = append(ys, float64(y))
+			}
+		}
+	}
+	if len(xs) < 100 {
+		return 0
+	}
+
+	diag := math.Hypot(float64(w), float64(h))
+	bins := make([]float64, int(2*diag)/step+2)
+	score := func(deg float64) float64 {
+		sin, cos := math.Sincos(deg * math.Pi / 180)
+		for i := range bins {
+			bins[i] = 0
+		}
+		for i := range xs {
+			bins[int((ys[i]*cos-xs[i]*sin+diag)/float64(step))]++
+		}
+		s := 0.0
+		for _, n := range bins {
+			s += n * n
+		}
+		return s
+	}
+
+	search := func(from, to, inc float64) float64 {
+		best, bestScore := 0.0, -1.0
+		for i := 0; from+float64(i)*inc <= to+inc/2; i++ {
+			deg := from + float64(i)*inc
+			// ties are left the least rotated
+			s := score(deg)
+			if s > bestScore || s == bestScore && math.Abs(deg) < math.Abs(best) {
+				best, bestScore = deg, s
+			}
+		}
+		return best
+	}
+	coarse := search(-maxDeg, maxDeg, 0.5)
+	fine := search(coarse-0.5, coarse+0.5, 0.05)
+	return fine * math.Pi / 180
+}
+
+// rotate rotates the image by the angle (in radians, counterclockwise
+// straightening lines of that clockwise angle) about its center, the
+// corners are filled white
+func rotate(g *image.Gray, angle float64) *image.Gray {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	sin, cos := math.Sincos(angle)
+	cx, cy := float64(w)/2, float64(h)/2
+
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 255
+		}
+		return float64(g.Pix[y*g.Stride+x])
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx := cx + dx*cos - dy*sin
+			sy := cy + dx*sin + dy*cos
+
+			// bilinear interpolation
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			v := at(x0, y0)*(1-fx)*(1-fy) + at(x0+1, y0)*fx*(1-fy) +
+				at(x0, y0+1)*(1-fx)*fy + at(x0+1, y0+1)*fx*fy
+			out.Pix[y*out.Stride+x] = uint8(v + 0.5)
+		}
+	}
+	return out
+}
+
+// contentBounds is the box of the content of the page, rows and columns
+// with only a few dark pixels are taken as specks rather than content
+func contentBounds(g *image.Gray, thresh uint8) image.Rectangle {
+	w, h := g.Rect.Dx(), g.Rect.Dy()
+	rows, cols := make([]int, h), make([]int, w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if g.Pix[y*g.Stride+x] < thresh {
+				rows[y]++
+				cols[x]++
+			}
+		}
+	}
+	span := func(counts []int, min int) (int, int) {
+		lo, hi := 0, len(counts)
+		for lo < hi && counts[lo] <= min {
+			lo++
+		}
+		for hi > lo && counts[hi-1] <= min {
+			hi--
+		}
+		return lo, hi
+	}
+	x0, x1 := span(cols, h/500+1)
+	y0, y1 := span(rows, w/500+1)
+	if x0 >= x1 || y0 >= y1 {
+		return g.Rect
+	}
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// threshold converts the image to black and white
+func threshold(g *image.Gray, thresh uint8) {
+	for i, v := range g.Pix {
+		if v < thresh {
+			g.Pix[i] = 0
+		} else {
+			g.Pix[i] = 255
+		}
+	}
+}
+
+// prepPage cleans up the page image
+func prepPage(im image.Image) *image.Gray {
+	g := toGray(im)
+	if trimFromFlag {
+		trimDarkEdges(g)
+	}
+	thresh := otsu(g)
+	if maxSkewFromFlag > 0 {
+		if angle := skewAngle(g, thresh, maxSkewFromFlag); angle != 0 {
+			g = rotate(g, angle)
+		}
+	}
+	if cropFromFlag {
+		b := contentBounds(g, thresh)
+		pad := int(padFromFlag * float64(g.Rect.Dx()+g.Rect.Dy()) / 2)
+		b = image.Rect(b.Min.X-pad, b.Min.Y-pad, b.Max.X+pad, b.Max.Y+pad).Intersect(g.Rect)
+		cropped := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(cropped, cropped.Bounds(), g, b.Min, draw.Src)
+		g = cropped
+	}
+	switch thresholdFromFlag {
+	case "":
+	case "auto":
+		threshold(g, thresh)
+	default:
+		t, _ := strconv.Atoi(thresholdFromFlag)
+		threshold(g, uint8(t))
+	}
+	return g
+}
+
+func readImageFile(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	im, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	return im, nil
+}
+
+func writePNGFile(file string, im image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, im); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prepOutFiles are the png files of the cleaned pages, the images may not
+// share a name apart from their extension
+func prepOutFiles(imgs []bookImage, outDir string) ([]string, error) {
+	var outFiles []string
+	from := make(map[string]string)
+	for _, img := range imgs {
+		base := path.Base(img.name)
+		outFile := path.Join(outDir, strings.TrimSuffix(base, path.Ext(base))+".png")
+		if other, ok := from[outFile]; ok {
+			return nil, fmt.Errorf("%v and %v would both be written to %v", other, img.name, outFile)
+		}
+		from[outFile] = img.name
+		outFiles = append(outFiles, outFile)
+	}
+	return outFiles, nil
+}
+
+func prepCmd(cmd *cobra.Command, args []string) error {
+	if t := thresholdFromFlag; t != "" && t != "auto" {
+		if n, err := strconv.Atoi(t); err != nil || n < 0 || n > 255 {
+			return fmt.Errorf("bad threshold %v, must be 0-255 or auto", t)
+		}
+	}
+	if padFromFlag < 0 {
+		return fmt.Errorf("bad pad %v, must not be negative", padFromFlag)
+	}
+	if maxSkewFromFlag < 0 || maxSkewFromFlag > 45 {
+		return fmt.Errorf("bad max-skew %v, must be 0-45 degrees", maxSkewFromFlag)
+	}
+	imgs, err := dirImages(args[0])
+	if err != nil {
+		return err
+	}
+	outDir := prepOutFromFlag
+	if outDir == "" {
+		outDir = strings.TrimSuffix(args[0], "/") + "_prepped"
+	}
+	outFiles, err := prepOutFiles(imgs, outDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// the pages are cleaned and written one at a time, then padded to the
+	// largest size once it's known
+	maxW, maxH := 0, 0
+	for i, img := range imgs {
+		im, err := readImageFile(img.name)
+		if err != nil {
+			return err
+		}
+		g := prepPage(im)
+		if g.Rect.Dx() > maxW {
+			maxW = g.Rect.Dx()
+		}
+		if g.Rect.Dy() > maxH {
+			maxH = g.Rect.Dy()
+		}
+
+		if err := writePNGFile(outFiles[i], g); err != nil {
+			return err
+		}
+		fmt.Printf("\rcleaned %d of %d pages", i+1, len(imgs))
+	}
+	fmt.Println()
+	if len(outFiles) == 0 {
+		return errors.New("no pages")
+	}
+
+	if normalizeFromFlag {
+		for _, outFile := range outFiles {
+			im, err := readImageFile(outFile)
+			if err != nil {
+				return err
+			}
+			b := im.Bounds()
+			if b.Dx() == maxW && b.Dy() == maxH {
+				continue
+			}
+			canvas := image.NewGray(image.Rect(0, 0, maxW, maxH))
+			draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+			at := image.Pt((maxW-b.Dx())/2, (maxH-b.Dy())/2)
+			draw.Draw(canvas, image.Rectangle{at, at.Add(b.Size())}, im, b.Min, draw.Src)
+			if err := writePNGFile(outFile, canvas); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("cleaned pages written to %v, see \"mt pdf alt-book %v\"\n", outDir, outDir)
+	return nil
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepOutFiles(t *testing.T) {
+	imgs := []bookImage{{name: "scans/p001.jpg"}, {name: "scans/p002.png"}}
+	outFiles, err := prepOutFiles(imgs, "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outFiles) != 2 || outFiles[0] != "out/p001.png" || outFiles[1] != "out/p002.png" {
+		t.Errorf("got %v", outFiles)
+	}
+
+	imgs = append(imgs, bookImage{name: "scans/p001.png"})
+	if _, err := prepOutFiles(imgs, "out"); err == nil {
+		t.Error("expected an error for p001.jpg and p001.png")
+	}
+}
+
+func TestPrepFlagValidation(t *testing.T) {
+	defer func(pad, skew float64) {
+		padFromFlag, maxSkewFromFlag = pad, skew
+	}(padFromFlag, maxSkewFromFlag)
+
+	for _, c := range []struct{ pad, skew float64 }{{-0.1, 5}, {0.03, -1}, {0.03, 46}} {
+		padFromFlag, maxSkewFromFlag = c.pad, c.skew
+		if err := prepCmd(nil, []string{"missing"}); err == nil ||
+			strings.Contains(err.Error(), "missing") {
+			t.Errorf("pad %v max-skew %v: expected a flag error, got %v", c.pad, c.skew, err)
+		}
+	}
+}
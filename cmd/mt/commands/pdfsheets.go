@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// printable sheets, the pages of a pdf are scaled and placed onto Letter
+// sheets as form xobjects according to an imposition
+
+const pointsPerInch = 72.0
+
+// sheetOptions are the dimensions (in inches) of the sheets
+type sheetOptions struct {
+	margin, gutter float64
+	marks          bool
+}
+
+// pdfNumber is the value of a pdf integer or real
+func (doc *pdfDoc) pdfNumber(obj pdfcpu.Object) (float64, error) {
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return 0, err
+	}
+	switch n := o.(type) {
+	case pdfcpu.Integer:
+		return float64(n), nil
+	case pdfcpu.Float:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("%v isn't a number", o)
+}
+
+// pageBox is the visible area of the page, its crop box or otherwise its
+// media box
+func (doc *pdfDoc) pageBox(page pdfcpu.Dict) ([4]float64, error) {
+	var box [4]float64
+	obj, ok := page["CropBox"]
+	if !ok {
+		if obj, ok = page["MediaBox"]; !ok {
+			return box, errors.New("page without a media box")
+		}
+	}
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return box, err
+	}
+	arr, ok := o.(pdfcpu.Array)
+	if !ok || len(arr) != 4 {
+		return box, errors.New("bad page box")
+	}
+	for i := range box {
+		if box[i], err = doc.pdfNumber(arr[i]); err != nil {
+			return box, err
+		}
+	}
+	return box, nil
+}
+
+// pageContent is the decoded content of the page, the streams of a
+// contents array are joined
+func (doc *pdfDoc) pageContent(page pdfcpu.Dict) ([]byte, error) {
+	obj, ok := page["Contents"]
+	if !ok {
+		return nil, nil
+	}
+	o, err := doc.ctx.Dereference(obj)
+	if err != nil {
+		return nil, err
+	}
+	streams := pdfcpu.Array{o}
+	if arr, ok := o.(pdfcpu.Array); ok {
+		streams = arr
+	}
+
+	var content bytes.Buffer
+	for _, s := range streams {
+		o, err := doc.ctx.Dereference(s)
+		if err != nil {
+			return nil, err
+		}
+		sd, ok := o.(pdfcpu.StreamDict)
+		if !ok {
+			return nil, errors.New("page contents aren't a stream")
+		}
+		if err := sd.Decode(); err != nil {
+			return nil, err
+		}
+		content.Write(sd.Content)
+		content.WriteByte('\n')
+	}
+	return content.Bytes(), nil
+}
+
+// newStream adds a stream object of the content
+func (doc *pdfDoc) newStream(d pdfcpu.Dict, content []byte) (*pdfcpu.IndirectRef, error) {
+	sd := pdfcpu.StreamDict{Dict: d, Content: content}
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return doc.ctx.IndRefForNewObject(sd)
+}
+
+// pageForm is a page as a form xobject which may be drawn onto a sheet
+type pageForm struct {
+	ref    pdfcpu.IndirectRef
+	box    [4]float64
+	rotate int
+}
+
+// size is the displayed width and height of the page
+func (f pageForm) size() (w, h float64) {
+	w, h = f.box[2]-f.box[0], f.box[3]-f.box[1]
+	if f.rotate == 90 || f.rotate == 270 {
+		return h, w
+	}
+	return w, h
+}
+
+// matrix places the page, as displayed, scaled at the position (points)
+func (f pageForm) matrix(scale, x, y float64) [6]float64 {
+	w, h := f.box[2]-f.box[0], f.box[3]-f.box[1]
+
+	// rotate clockwise by the page rotation within the displayed size
+	var m [6]float64
+	switch f.rotate {
+	case 90:
+		m = [6]float64{0, -1, 1, 0, 0, w}
+	case 180:
+		m = [6]float64{-1, 0, 0, -1, w, h}
+	case 270:
+		m = [6]float64{0, 1, -1, 0, h, 0}
+	default:
+		m = [6]float64{1, 0, 0, 1, 0, 0}
+	}
+
+	// from the origin of the box
+	m[4] -= m[0]*f.box[0] + m[2]*f.box[1]
+	m[5] -= m[1]*f.box[0] + m[3]*f.box[1]
+	for i := range m {
+		m[i] *= scale
+	}
+	m[4] += x
+	m[5] += y
+	return m
+}
+
+// pageForm makes a form xobject of the page
+func (doc *pdfDoc) pageForm(i int) (pageForm, error) {
+	page := doc.pages[i]
+	box, err := doc.pageBox(page)
+	if err != nil {
+		return pageForm{}, err
+	}
+	rotate := 0
+	if obj, ok := page["Rotate"]; ok {
+		r, err := doc.pdfNumber(obj)
+		if err != nil {
+			return pageForm{}, err
+		}
+		rotate = (int(r)%360 + 360) % 360
+	}
+	content, err := doc.pageContent(page)
+	if err != nil {
+		return pageForm{}, fmt.Errorf("page %d: %v", i+1, err)
+	}
+
+	d := pdfcpu.Dict{
+		"Type":    pdfcpu.Name("XObject"),
+		"Subtype": pdfcpu.Name("Form"),
+		"BBox": pdfcpu.Array{pdfcpu.Float(box[0]), pdfcpu.Float(box[1]),
+			pdfcpu.Float(box[2]), pdfcpu.Float(box[3])},
+	}
+	if res, ok := page["Resources"]; ok {
+		d["Resources"] = res
+	}
+	ref, err := doc.newStream(d, content)
+	if err != nil {
+		return pageForm{}, err
+	}
+	return pageForm{*ref, box, rotate}, nil
+}
+
+// drawMark adds a short line, dashed for folds, to the content
+func drawMark(content *bytes.Buffer, x1, y1, x2, y2 float64, fold bool) {
+	dash := "[] 0 d"
+	if fold {
+		dash = "[3 2] 0 d"
+	}
+	fmt.Fprintf(content, "q 0.5 w %s %.2f %.2f m %.2f %.2f l S Q\n", dash, x1, y1, x2, y2)
+}
+
+// imposeSheets replaces the pages with the printed sides of the sheets
+func (doc *pdfDoc) imposeSheets(imp imposition, opts sheetOptions) error {
+	l := imp.layout
+	sheetW, sheetH := 8.5*pointsPerInch, 11*pointsPerInch
+	if l.landscape {
+		sheetW, sheetH = sheetH, sheetW
+	}
+	margin, gutter := opts.margin*pointsPerInch, opts.gutter*pointsPerInch
+	cellW := (sheetW - 2*margin - float64(l.cols-1)*gutter) / float64(l.cols)
+	cellH := (sheetH - 2*margin - float64(l.rows-1)*gutter) / float64(l.rows)
+	if cellW <= 0 || cellH <= 0 {
+		return errors.New("the margins and gutter leave no room for the pages")
+	}
+
+	forms := make(map[int]pageForm)
+	var sides []pdfcpu.Dict
+	for _, side := range imp.sides {
+		var content bytes.Buffer
+		xobjects := pdfcpu.Dict{}
+		for slot, p := range side {
+			if p.page < 0 {
+				continue
+			}
+			form, ok := forms[p.page]
+			if !ok {
+				var err error
+				if form, err = doc.pageForm(p.page); err != nil {
+					return err
+				}
+				forms[p.page] = form
+			}
+
+			// scale to fit the cell, centered, pdf coordinates are from
+			// the bottom of the sheet
+			col, row := l.slotPos(slot)
+			w, h := form.size()
+			scale := cellW / w
+			if cellH/h < scale {
+				scale = cellH / h
+			}
+			x := margin + float64(col)*(cellW+gutter) + (cellW-w*scale)/2 + p.shift*pointsPerInch
+			y := sheetH - margin - float64(row)*(cellH+gutter) - cellH + (cellH-h*scale)/2
+			m := form.matrix(scale, x, y)
+
+			name := fmt.Sprintf("Pg%d", p.page+1)
+			xobjects[name] = form.ref
+			fmt.Fprintf(&content, "q %.4f %.4f %.4f %.4f %.4f %.4f cm /%s Do Q\n",
+				m[0], m[1], m[2], m[3], m[4], m[5], name)
+		}
+
+		// marks within the margins at the trim edges and at the folds or
+		// cuts between the cells
+		if opts.marks && margin > 0 {
+			length := margin * 0.75
+			xs := []float64{margin, sheetW - margin}
+			for col := 1; col < l.cols; col++ {
+				xs = append(xs, margin+float64(col)*(cellW+gutter)-gutter/2)
+			}
+			for i, x := range xs {
+				fold := l.folded && i >= 2
+				drawMark(&content, x, 0, x, length, fold)
+				drawMark(&content, x, sheetH-length, x, sheetH, fold)
+			}
+			ys := []float64{margin, sheetH - margin}
+			for row := 1; row < l.rows; row++ {
+				ys = append(ys, margin+float64(row)*(cellH+gutter)-gutter/2)
+			}
+			for _, y := range ys {
+				drawMark(&content, 0, y, length, y, false)
+				drawMark(&content, sheetW-length, y, sheetW, y, false)
+			}
+		}
+
+		ref, err := doc.newStream(pdfcpu.Dict{}, content.Bytes())
+		if err != nil {
+			return err
+		}
+		sides = append(sides, pdfcpu.Dict{
+			"Type":      pdfcpu.Name("Page"),
+			"MediaBox":  pdfcpu.Array{pdfcpu.Integer(0), pdfcpu.Integer(0), pdfcpu.Float(sheetW), pdfcpu.Float(sheetH)},
+			"Resources": pdfcpu.Dict{"XObject": xobjects},
+			"Contents":  *ref,
+		})
+	}
+	return doc.replacePages(sides)
+}
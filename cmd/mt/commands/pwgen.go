@@ -2,13 +2,13 @@ package commands
 
 import (
 	cryptorand "crypto/rand"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	mathrand "math/rand"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
-	"github.com/atotto/clipboard"
 	"github.com/spf13/cobra"
 )
 
@@ -17,54 +17,281 @@ var (
 	PWGenCmd = &cobra.Command{
 		Use:   "pw [length] [chset]",
 		Short: "pw generator; chset can be \"simple\", or \"adv\"",
-		RunE:  pwGenCmd,
+		Long: `pw generator; chset can be "simple", or "adv"
+
+Characters are chosen uniformly with crypto/rand. The simple set is letters
+and digits, adv adds symbols, or a custom set may be provided with --chars.
+The length may be omitted when --min-entropy is set, in which case the
+shortest password reaching the entropy is generated.`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: pwGenCmd,
 	}
 )
 
+var (
+	pwIO                textIO
+	requireFromFlag     string
+	noAmbiguousFromFlag bool
+	charsFromFlag       string
+	excludeFromFlag     string
+	minEntropyFromFlag  float64
+)
+
+// character classes, the simple chset is lower, upper and digit while adv
+// includes symbols
+const (
+	chsetLower     = "abcdefghijklmnopqrstuvwxyz"
+	chsetUpper     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	chsetDigit     = "0123456789"
+	chsetSymbol    = `!@#$%^&*()-_+=[]{}<>?,.~`
+	ambiguousChars = `Il1|O0o`
+	pwCharClasses  = "lower,upper,digit,symbol"
+)
+
 func init() {
+	addPWPolicyFlags(PWGenCmd)
+	PWGenCmd.PersistentFlags().Float64Var(&minEntropyFromFlag, "min-entropy", 0,
+		"minimum bits of entropy, errors if the length falls short")
+	addTextIOFlags(PWGenCmd, &pwIO, false)
 	RootCmd.AddCommand(PWGenCmd)
 }
 
-func pwGenCmd(cmd *cobra.Command, args []string) error {
+// addPWPolicyFlags registers the flags setting the character set of
+// generated passwords
+func addPWPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&requireFromFlag, "require", "",
+		"character classes which must each appear, ex. \"upper,digit\" or \"all\" ("+pwCharClasses+")")
+	cmd.Flags().BoolVar(&noAmbiguousFromFlag, "no-ambiguous", false,
+		"exclude characters which are easily confused, ex. l, 1, O and 0")
+	cmd.Flags().StringVar(&charsFromFlag, "chars", "",
+		"custom character set to choose from")
+	cmd.Flags().StringVar(&excludeFromFlag, "exclude", "",
+		"characters to exclude from the set")
+}
+
+// pwPolicy is the character set of a password along with the classes of
+// which at least one character must appear
+type pwPolicy struct {
+	set      []rune
+	required [][]rune
+}
 
-	chsetSimple := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j",
-		"k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y",
-		"z", "A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N",
-		"O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z", "0", "1", "2",
-		"3", "4", "5", "6", "7", "8", "9"}
+// charClass returns the characters of a class
+func charClass(class string) (string, error) {
+	switch class {
+	case "lower":
+		return chsetLower, nil
+	case "upper":
+		return chsetUpper, nil
+	case "digit":
+		return chsetDigit, nil
+	case "symbol":
+		return chsetSymbol, nil
+	}
+	return "", fmt.Errorf("unknown character class %v, must be one of %v", class, pwCharClasses)
+}
 
-	chsetAdv := []string{`!`, `@`, `#`, `$`, `%`, `^`, `&`, `*`, `(`, `)`, `-`,
-		`_`, `+`, `=`, `[`, `]`, `{`, `}`, `<`, `>`, `?`, `,`, `.`, `~`}
-	chsetAdv = append(chsetAdv, chsetSimple...)
+// newPWPolicy builds the policy from the chset argument and flags
+func newPWPolicy(chset string) (pwPolicy, error) {
+	chars := chsetLower + chsetUpper + chsetDigit + chsetSymbol
+	switch {
+	case charsFromFlag != "":
+		chars = charsFromFlag
+	case chset == "simple":
+		chars = chsetLower + chsetUpper + chsetDigit
+	case chset == "" || chset == "adv":
+	default:
+		return pwPolicy{}, fmt.Errorf("unknown chset %v, must be simple or adv", chset)
+	}
 
-	chset := chsetAdv
-	if len(args) == 2 && args[1] == "simple" {
-		chset = chsetSimple
+	excluded := excludeFromFlag
+	if noAmbiguousFromFlag {
+		excluded += ambiguousChars
 	}
+	keep := func(r rune) bool { return !strings.ContainsRune(excluded, r) }
 
-	if len(args) < 1 {
-		return errors.New("must provide a length argument")
+	var p pwPolicy
+	seen := make(map[rune]bool)
+	for _, r := range chars {
+		if keep(r) && !seen[r] {
+			seen[r] = true
+			p.set = append(p.set, r)
+		}
 	}
-	pwLen, err := strconv.Atoi(args[0])
+	if len(p.set) < 2 {
+		return pwPolicy{}, errors.New("the character set must have at least 2 characters")
+	}
+
+	if requireFromFlag == "" {
+		return p, nil
+	}
+	require := requireFromFlag
+	if require == "all" {
+		require = pwCharClasses
+	}
+	for _, class := range strings.Split(require, ",") {
+		classChars, err := charClass(strings.TrimSpace(class))
+		if err != nil {
+			return pwPolicy{}, err
+		}
+		var inSet []rune
+		for _, r := range classChars {
+			if seen[r] {
+				inSet = append(inSet, r)
+			}
+		}
+
+		// "all" only requires the classes found in the set
+		if len(inSet) == 0 && requireFromFlag == "all" {
+			continue
+		}
+		if len(inSet) == 0 {
+			return pwPolicy{}, fmt.Errorf("no %v characters in the character set", class)
+		}
+		p.required = append(p.required, inSet)
+	}
+	return p, nil
+}
+
+// randIndex returns an unbiased random index below n
+func randIndex(n int) (int, error) {
+	i, err := cryptorand.Int(cryptorand.Reader, big.NewInt(int64(n)))
 	if err != nil {
-		return fmt.Errorf("bad pw length, error: %v", err)
+		return 0, fmt.Errorf("error reading random: %v", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// generate chooses each character uniformly, passwords missing a required
+// class are discarded so each valid password is equally likely
+func (p pwPolicy) generate(length int) (string, error) {
+	if length < len(p.required) {
+		return "", fmt.Errorf("length %d is too short for %d required classes",
+			length, len(p.required))
+	}
+	for {
+		pw := make([]rune, length)
+		for i := range pw {
+			j, err := randIndex(len(p.set))
+			if err != nil {
+				return "", err
+			}
+			pw[i] = p.set[j]
+		}
+		if p.satisfied(pw) {
+			return string(pw), nil
+		}
 	}
+}
+
+func (p pwPolicy) satisfied(pw []rune) bool {
+	for _, class := range p.required {
+		found := false
+		for _, r := range pw {
+			if strings.ContainsRune(string(class), r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// entropy is log2 of the number of passwords of the length meeting the
+// policy, counted by inclusion-exclusion over the required classes
+func (p pwPolicy) entropy(length int) float64 {
+	count := new(big.Int)
+	n := len(p.required)
+	for subset := 0; subset < 1<<uint(n); subset++ {
+		excluded, bits := 0, 0
+		for i := 0; i < n; i++ {
+			if subset&(1<<uint(i)) != 0 {
+				excluded += len(p.required[i])
+				bits++
+			}
+		}
+		term := new(big.Int).Exp(big.NewInt(int64(len(p.set)-excluded)), big.NewInt(int64(length)), nil)
+		if bits%2 == 1 {
+			count.Sub(count, term)
+		} else {
+			count.Add(count, term)
+		}
+	}
+	return bigLog2(count)
+}
 
-	var bz [8]byte
-	_, err = cryptorand.Read(bz[:])
+// bigLog2 is log2 of a positive big integer
+func bigLog2(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	shift := 0
+	if bl := n.BitLen(); bl > 64 {
+		shift = bl - 64
+	}
+	f, _ := new(big.Float).SetInt(new(big.Int).Rsh(n, uint(shift))).Float64()
+	return math.Log2(f) + float64(shift)
+}
+
+// lengthForEntropy is the shortest length reaching the entropy
+func (p pwPolicy) lengthForEntropy(bits float64) int {
+	length := len(p.required)
+	if length == 0 {
+		length = 1
+	}
+	for p.entropy(length) < bits {
+		length++
+	}
+	return length
+}
+
+// generatePW generates a password from the [length] [chset] arguments and
+// flags, the length is defaultLen when not provided (0 requires it)
+func generatePW(args []string, defaultLen int) (pw string, pwLen int, bits float64, err error) {
+	chset := ""
+	if len(args) == 2 {
+		chset = args[1]
+	}
+	policy, err := newPWPolicy(chset)
 	if err != nil {
-		return fmt.Errorf("error getting random seed: %v", err)
+		return "", 0, 0, err
+	}
+
+	switch {
+	case len(args) >= 1:
+		pwLen, err = strconv.Atoi(args[0])
+		if err != nil || pwLen < 1 {
+			return "", 0, 0, fmt.Errorf("bad pw length %v", args[0])
+		}
+	case minEntropyFromFlag > 0:
+		pwLen = policy.lengthForEntropy(minEntropyFromFlag)
+	case defaultLen > 0:
+		pwLen = defaultLen
+	default:
+		return "", 0, 0, errors.New("must provide a length argument (or --min-entropy)")
+	}
+
+	bits = policy.entropy(pwLen)
+	if bits < minEntropyFromFlag {
+		return "", 0, 0, fmt.Errorf("a length of %d has %.1f bits of entropy, short of %v (use a length of %d)",
+			pwLen, bits, minEntropyFromFlag, policy.lengthForEntropy(minEntropyFromFlag))
 	}
-	seed := int64(binary.LittleEndian.Uint64(bz[:]))
-	mathrand.Seed(seed)
 
-	// generate the pw
-	maxN := len(chset) - 1
-	out := ""
-	for i := 0; i < pwLen; i++ {
-		out += chset[mathrand.Intn(maxN)]
+	pw, err = policy.generate(pwLen)
+	return pw, pwLen, bits, err
+}
+
+func pwGenCmd(cmd *cobra.Command, args []string) error {
+	out, pwLen, bits, err := generatePW(args, 0)
+	if err != nil {
+		return err
+	}
+	if err := pwIO.write(out); err != nil {
+		return err
 	}
-	clipboard.WriteAll(out)
-	fmt.Println("pw added to clipboard")
+	pwIO.status("pw added to %v (%d characters, %.1f bits of entropy)", pwIO.destination(), pwLen, bits)
 	return nil
 }
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// diceware passphrases
+var (
+	PWPhraseCmd = &cobra.Command{
+		Use:   "phrase [words]",
+		Short: "diceware passphrase generator",
+		Long: `diceware passphrase generator
+
+Words are chosen uniformly with crypto/rand from the EFF large wordlist (7776
+words, 12.9 bits of entropy each) or from a wordlist file of one word per
+line (lines of dice rolls followed by a word are also accepted). The number
+of words may be omitted when --min-entropy is set.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: pwPhraseCmd,
+	}
+)
+
+var (
+	wordlistFromFlag string
+	sepFromFlag      string
+	capsFromFlag     string
+	digitsFromFlag   int
+)
+
+func init() {
+	PWPhraseCmd.Flags().StringVar(&wordlistFromFlag, "wordlist", "",
+		"file of words to use instead of the EFF large wordlist")
+	PWPhraseCmd.Flags().StringVar(&sepFromFlag, "sep", "-",
+		"separator between words")
+	PWPhraseCmd.Flags().StringVar(&capsFromFlag, "caps", "none",
+		"capitalization: none, first (of each word), upper, or random (first letter of random words)")
+	PWPhraseCmd.Flags().IntVar(&digitsFromFlag, "digits", 0,
+		"insert a number of this many random digits between two random words")
+	PWGenCmd.AddCommand(PWPhraseCmd)
+}
+
+// readWordlist reads a word from each line, lines of diceware lists such as
+// "11111 abacus" use the last field, duplicates are dropped
+func readWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		word := strings.ToLower(fields[len(fields)-1])
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) < 2 {
+		return nil, fmt.Errorf("wordlist %v must have at least 2 different words", path)
+	}
+	return words, nil
+}
+
+// phrasePolicy is the wordlist and options of a passphrase
+type phrasePolicy struct {
+	words  []string
+	sep    string
+	caps   string
+	digits int
+}
+
+func newPhrasePolicy() (phrasePolicy, error) {
+	p := phrasePolicy{
+		words:  effWordlist,
+		sep:    sepFromFlag,
+		caps:   capsFromFlag,
+		digits: digitsFromFlag,
+	}
+	if wordlistFromFlag != "" {
+		words, err := readWordlist(wordlistFromFlag)
+		if err != nil {
+			return phrasePolicy{}, err
+		}
+		p.words = words
+	}
+	switch p.caps {
+	case "none", "first", "upper", "random":
+	default:
+		return phrasePolicy{}, fmt.Errorf("bad --caps %v, must be none, first, upper or random", p.caps)
+	}
+	if p.digits < 0 {
+		return phrasePolicy{}, errors.New("--digits can't be negative")
+	}
+	return p, nil
+}
+
+// entropy of a passphrase of n words, random capitalization adds a bit per
+// word and the digits add their own entropy along with their position
+func (p phrasePolicy) entropy(n int) float64 {
+	bits := float64(n) * math.Log2(float64(len(p.words)))
+	if p.caps == "random" {
+		bits += float64(n)
+	}
+	if p.digits > 0 {
+		bits += float64(p.digits)*math.Log2(10) + math.Log2(float64(n+1))
+	}
+	return bits
+}
+
+// wordsForEntropy is the fewest words reaching the entropy
+func (p phrasePolicy) wordsForEntropy(bits float64) int {
+	n := 1
+	for p.entropy(n) < bits {
+		n++
+	}
+	return n
+}
+
+func capitalize(word string) string {
+	rs := []rune(word)
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
+
+func (p phrasePolicy) generate(n int) (string, error) {
+	var parts []string
+	for i := 0; i < n; i++ {
+		j, err := randIndex(len(p.words))
+		if err != nil {
+			return "", err
+		}
+		word := p.words[j]
+		switch p.caps {
+		case "first":
+			word = capitalize(word)
+		case "upper":
+			word = strings.ToUpper(word)
+		case "random":
+			coin, err := randIndex(2)
+			if err != nil {
+				return "", err
+			}
+			if coin == 1 {
+				word = capitalize(word)
+			}
+		}
+		parts = append(parts, word)
+	}
+
+	if p.digits > 0 {
+		var digits []byte
+		for i := 0; i < p.digits; i++ {
+			d, err := randIndex(10)
+			if err != nil {
+				return "", err
+			}
+			digits = append(digits, byte('0'+d))
+		}
+		pos, err := randIndex(n + 1)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts[:pos], append([]string{string(digits)}, parts[pos:]...)...)
+	}
+	return strings.Join(parts, p.sep), nil
+}
+
+func pwPhraseCmd(cmd *cobra.Command, args []string) error {
+	policy, err := newPhrasePolicy()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	switch {
+	case len(args) == 1:
+		n, err = strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad number of words %v", args[0])
+		}
+	case minEntropyFromFlag > 0:
+		n = policy.wordsForEntropy(minEntropyFromFlag)
+	default:
+		n = 6
+	}
+
+	bits := policy.entropy(n)
+	if bits < minEntropyFromFlag {
+		return fmt.Errorf("%d words have %.1f bits of entropy, short of %v (use %d words)",
+			n, bits, minEntropyFromFlag, policy.wordsForEntropy(minEntropyFromFlag))
+	}
+
+	out, err := policy.generate(n)
+	if err != nil {
+		return err
+	}
+	if err := pwIO.write(out); err != nil {
+		return err
+	}
+	pwIO.status("passphrase added to %v (%d words, %.1f bits of entropy)", pwIO.destination(), n, bits)
+	return nil
+}
@@ -0,0 +1,475 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/spf13/cobra"
+)
+
+// recipe commands
+var (
+	RecipeCmd = &cobra.Command{
+		Use:   "recipe",
+		Short: "recipe utilities",
+	}
+	ScaleRecipeCmd = &cobra.Command{
+		Use:   "scale [file] <factor>",
+		Short: "scale the ingredients of a recipe",
+		Long: `scale the ingredients of a recipe by a factor or to a number of servings
+
+Each line of the recipe beginning with an amount and a unit is treated as an
+ingredient, ex. "1 1/2 cups flour", as is any line beginning with an amount
+under an "Ingredients" heading, ex. "3 apples". All other lines (including
+"20 minutes at 350F" and numbered steps such as "1. Preheat the oven") are
+kept as is. Only cooking units are recognized, "t" is a teaspoon, "T" a
+tablespoon and "c" or "C" a cup. To scale by servings the recipe must include
+a line such as "serves: 4".`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: scaleRecipeCmd,
+	}
+)
+
+var (
+	servingsFromFlag int
+	systemFromFlag   string
+	recipeOutFlag    string
+	recipePDFFlag    bool
+)
+
+func init() {
+	ScaleRecipeCmd.PersistentFlags().IntVar(&servingsFromFlag, "servings", 0,
+		"scale to this number of servings instead of by a factor")
+	ScaleRecipeCmd.PersistentFlags().StringVar(&systemFromFlag, "system", "",
+		"convert all units to \"metric\" or \"imperial\"")
+	ScaleRecipeCmd.PersistentFlags().StringVar(&recipeOutFlag, "out", "",
+		"file to write the scaled recipe to (default stdout, or <file>_scaled.pdf)")
+	ScaleRecipeCmd.PersistentFlags().BoolVar(&recipePDFFlag, "pdf", false,
+		"write the scaled recipe as a printable pdf")
+	RecipeCmd.AddCommand(ScaleRecipeCmd)
+	RootCmd.AddCommand(RecipeCmd)
+}
+
+// recipeUnit is a unit used when normalizing ingredient amounts, the unit is
+// only used for amounts of at least min
+type recipeUnit struct {
+	name, display string
+	min           float64
+}
+
+// never is the min of units which are converted from but never to
+var never = math.Inf(1)
+
+// units of each system, smallest to largest
+var recipeSystems = map[string]map[dimension][]recipeUnit{
+	"metric": {
+		dimVolume: {{"mL", "mL", 0}, {"L", "L", 1}},
+		dimWeight: {{"g", "g", 0}, {"kg", "kg", 1}},
+	},
+	"imperial": {
+		dimVolume: {{"teaspoon", "tsp", 0}, {"tablespoon", "tbsp", 1}, {"floz", "fl oz", never},
+			{"cup", "cup", 0.25}, {"pint", "pint", never}, {"quart", "quart", never}, {"gal", "gal", never}},
+		dimWeight: {{"oz", "oz", 0}, {"pound", "lb", 1}},
+	},
+}
+
+// unitSystem returns the system a unit belongs to
+func unitSystem(unit string) string {
+	for system, dims := range recipeSystems {
+		for _, rus := range dims {
+			for _, ru := range rus {
+				if ru.name == unit {
+					return system
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// cookingUnits are the units recognized in recipes, by how they're written,
+// so that ex. "t" is a teaspoon rather than a tonne
+var cookingUnits = map[string]string{
+	"t": "teaspoon", "tsp": "teaspoon", "teaspoon": "teaspoon",
+	"T": "tablespoon", "tbs": "tablespoon", "tbls": "tablespoon",
+	"tbsp": "tablespoon", "tablespoon": "tablespoon",
+	"c": "cup", "C": "cup", "cup": "cup",
+	"floz": "floz", "pint": "pint", "pt": "pint", "quart": "quart", "qt": "quart",
+	"gal": "gal", "gallon": "gal",
+	"ml": "mL", "mL": "mL", "l": "L", "L": "L", "liter": "L", "litre": "L",
+	"mg": "mg", "g": "g", "gram": "g", "kg": "kg", "kilogram": "kg",
+	"oz": "oz", "ounce": "oz", "lb": "pound", "pound": "pound",
+}
+
+// cookingUnit resolves a unit as written in a recipe, plurals and
+// capitalized words are accepted along with equivalence units (ex. "eggs")
+func cookingUnit(text string) (string, bool) {
+	for _, name := range []string{text, strings.ToLower(text)} {
+		if unit, found := cookingUnits[name]; found {
+			return unit, true
+		}
+		if isEquivalenceUnit(name) {
+			if unit, found := unitAlias[name]; found {
+				return unit, true
+			}
+			return name, true
+		}
+		if len(name) > 2 && strings.HasSuffix(name, "s") {
+			if unit, found := cookingUnit(strings.TrimSuffix(name, "s")); found {
+				return unit, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ingredient is a single parsed line of a recipe
+type ingredient struct {
+	amount   interval
+	unit     string // registered or equivalence unit, if any
+	unitText string // unit as written
+	rest     string // material and notes
+}
+
+var unicodeFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8,
+}
+
+// parseRecipeNumber parses "2", "1.5", "1/2", "½" or "1½", a trailing
+// period is a numbered step ("1.") rather than an amount
+func parseRecipeNumber(s string) (float64, bool) {
+	if s == "" || strings.HasSuffix(s, ".") {
+		return 0, false
+	}
+	rs := []rune(s)
+	if frac, found := unicodeFractions[rs[len(rs)-1]]; found {
+		if len(rs) == 1 {
+			return frac, true
+		}
+		whole, err := strconv.ParseFloat(string(rs[:len(rs)-1]), 64)
+		if err != nil {
+			return 0, false
+		}
+		return whole + frac, true
+	}
+	if split := strings.SplitN(s, "/", 2); len(split) == 2 {
+		num, err1 := strconv.ParseFloat(split[0], 64)
+		den, err2 := strconv.ParseFloat(split[1], 64)
+		if err1 != nil || err2 != nil || den == 0 {
+			return 0, false
+		}
+		return num / den, true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// parseRecipeAmount parses an amount from the start of the fields, including
+// mixed numbers ("1 1/2") and ranges ("2-3"), returning the fields consumed
+func parseRecipeAmount(fields []string) (interval, int, bool) {
+	if len(fields) == 0 {
+		return interval{}, 0, false
+	}
+	for _, sep := range []string{"..", "-", "–"} {
+		if split := strings.SplitN(fields[0], sep, 2); len(split) == 2 {
+			lo, ok1 := parseRecipeNumber(split[0])
+			hi, ok2 := parseRecipeNumber(split[1])
+			if ok1 && ok2 {
+				return bounds(lo, hi), 1, true
+			}
+		}
+	}
+	v, ok := parseRecipeNumber(fields[0])
+	if !ok {
+		return interval{}, 0, false
+	}
+	if len(fields) > 1 && strings.Contains(fields[1], "/") {
+		if frac, ok := parseRecipeNumber(fields[1]); ok && frac < 1 {
+			return exact(v + frac), 2, true
+		}
+	}
+	return exact(v), 1, true
+}
+
+// parseIngredient parses a line beginning with an amount
+func parseIngredient(line string) (ingredient, bool) {
+	fields := strings.Fields(line)
+	amount, n, ok := parseRecipeAmount(fields)
+	if !ok {
+		return ingredient{}, false
+	}
+	ing := ingredient{amount: amount}
+	fields = fields[n:]
+	punct := ""
+	if len(fields) > 0 {
+		unitText := strings.TrimRight(fields[0], ".,")
+		if unit, found := cookingUnit(unitText); found {
+			ing.unit = unit
+			ing.unitText = unitText
+			// keep any comma, abbreviation periods are dropped
+			punct = strings.Replace(strings.TrimPrefix(fields[0], unitText), ".", "", -1)
+			fields = fields[1:]
+		}
+	}
+	ing.rest = strings.TrimSpace(punct + " " + strings.Join(fields, " "))
+	return ing, true
+}
+
+// normalize converts the ingredient into the most readable unit of the
+// system, keeping the unit's own system if none is provided
+func (ing ingredient) normalize(system string) ingredient {
+	u, found := lookupUnit(ing.unit)
+	if !found {
+		return ing
+	}
+	if system == "" {
+		system = unitSystem(u.name)
+	}
+	candidates := recipeSystems[system][u.dim]
+	if len(candidates) == 0 {
+		return ing
+	}
+
+	amountSI := ing.amount.mul(exact(u.factor))
+	best := candidates[0]
+	for _, ru := range candidates[1:] {
+		ruDef, _ := lookupUnit(ru.name)
+		if amountSI.lo/ruDef.factor >= ru.min {
+			best = ru
+		}
+	}
+	bestDef, _ := lookupUnit(best.name)
+	ing.amount = amountSI.scale(1 / bestDef.factor)
+	ing.unit = best.name
+	ing.unitText = best.display
+	return ing
+}
+
+// formatRecipeAmount prints imperial amounts as the nearest kitchen fraction,
+// ex. "1 1/2", and metric amounts to three significant figures
+func formatRecipeAmount(v float64, fractional bool) string {
+	if !fractional {
+		return strconv.FormatFloat(v, 'g', 3, 64)
+	}
+
+	// use the closest fraction, preferring smaller denominators
+	num, den := 0, 1
+	bestErr := math.Inf(1)
+	for _, d := range []int{1, 2, 3, 4, 8} {
+		n := int(math.Round(v * float64(d)))
+		if err := math.Abs(v - float64(n)/float64(d)); err < bestErr-1e-9 {
+			num, den, bestErr = n, d, err
+		}
+	}
+	if num == 0 && v > 0 {
+		return strconv.FormatFloat(v, 'g', 2, 64)
+	}
+	whole, rem := num/den, num%den
+	var frac string
+	if rem != 0 {
+		frac = fmt.Sprintf("%d/%d", rem, den)
+	}
+	switch {
+	case whole == 0 && frac == "":
+		return "0"
+	case whole == 0:
+		return frac
+	case frac == "":
+		return strconv.Itoa(whole)
+	}
+	return fmt.Sprintf("%d %v", whole, frac)
+}
+
+func (ing ingredient) String() string {
+	fractional := unitSystem(ing.unit) != "metric"
+	amount := ing.amount.format(func(v float64) string { return formatRecipeAmount(v, fractional) })
+	parts := []string{amount}
+	if ing.unitText != "" {
+		unit := ing.unitText
+
+		// cups and counted units (ex. eggs) are pluralized
+		_, registered := lookupUnit(ing.unit)
+		if ing.unit == "cup" || !registered {
+			unit = ing.unit
+			if ing.amount.hi > 1 {
+				unit += "s"
+			}
+		}
+		parts = append(parts, unit)
+	}
+	out := strings.Join(parts, " ")
+	if ing.rest != "" && !strings.HasPrefix(ing.rest, ",") {
+		out += " "
+	}
+	return out + ing.rest
+}
+
+// parseServings parses a line such as "serves: 4"
+func parseServings(line string) (prefix string, servings float64, ok bool) {
+	l := strings.TrimSpace(line)
+	for _, p := range []string{"serves", "servings", "yield"} {
+		if !strings.HasPrefix(strings.ToLower(l), p) {
+			continue
+		}
+		after := strings.TrimLeft(l[len(p):], ": ")
+		fields := strings.Fields(after)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, ok := parseRecipeNumber(fields[0]); ok && v > 0 {
+			return l[:len(l)-len(after)], v, true
+		}
+	}
+	return "", 0, false
+}
+
+// recipeServings returns the servings declared by the recipe
+func recipeServings(lines []string) (float64, bool) {
+	for _, line := range lines {
+		if _, servings, ok := parseServings(line); ok {
+			return servings, true
+		}
+	}
+	return 0, false
+}
+
+// recipeHeading parses a markdown heading, or a section name such as
+// "Directions:" on a line of its own, returning the lowercase name and the
+// markdown level (0 for a section name)
+func recipeHeading(line string) (name string, level int, ok bool) {
+	l := strings.TrimSpace(line)
+	level = len(l) - len(strings.TrimLeft(l, "#"))
+	name = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(l[level:]), ":")))
+	if level > 0 {
+		return name, level, true
+	}
+	switch name {
+	case "ingredients", "directions", "instructions", "method", "steps", "preparation", "notes":
+		return name, 0, true
+	}
+	return "", 0, false
+}
+
+// scaleRecipe scales each ingredient line of the recipe, keeping any
+// indentation and list marker, all other lines are kept as is. Lines are
+// ingredients when their amount is followed by a unit, or when they're
+// within an ingredients section where ex. "3 apples" has no unit.
+func scaleRecipe(lines []string, factor float64, system string) []string {
+	var out []string
+	inIngredients, ingredientsLevel := false, 0
+	for _, line := range lines {
+		if prefix, servings, ok := parseServings(line); ok {
+			out = append(out, prefix+formatRecipeAmount(servings*factor, true))
+			continue
+		}
+		if name, level, ok := recipeHeading(line); ok {
+			switch {
+			case name == "ingredients":
+				inIngredients, ingredientsLevel = true, level
+			case level == 0 || ingredientsLevel == 0 || level <= ingredientsLevel:
+				// subheadings of the ingredients, ex. "### Sauce", remain within
+				inIngredients = false
+			}
+			out = append(out, line)
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		for _, b := range []string{"- ", "* ", "+ "} {
+			if strings.HasPrefix(trimmed, b) {
+				trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, b), " \t")
+				break
+			}
+		}
+		marker := line[:len(line)-len(trimmed)]
+		ing, ok := parseIngredient(trimmed)
+		if !ok || ing.unit == "" && !inIngredients {
+			out = append(out, line)
+			continue
+		}
+		ing.amount = ing.amount.scale(factor)
+		ing = ing.normalize(system)
+		out = append(out, marker+ing.String())
+	}
+	return out
+}
+
+func scaleRecipeCmd(cmd *cobra.Command, args []string) error {
+	if systemFromFlag != "" {
+		if _, found := recipeSystems[systemFromFlag]; !found {
+			return fmt.Errorf("unknown system %v, must be \"metric\" or \"imperial\"", systemFromFlag)
+		}
+	}
+
+	bz, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(bz), "\n"), "\n")
+
+	var factor float64
+	switch {
+	case servingsFromFlag > 0:
+		servings, found := recipeServings(lines)
+		if !found {
+			return errors.New("recipe does not declare its servings (ex. \"serves: 4\")")
+		}
+		factor = float64(servingsFromFlag) / servings
+	case len(args) == 2:
+		var ok bool
+		factor, ok = parseRecipeNumber(args[1])
+		if !ok || factor <= 0 {
+			return fmt.Errorf("bad scaling factor %v", args[1])
+		}
+	default:
+		return errors.New("must provide a scaling factor or --servings")
+	}
+
+	scaled := scaleRecipe(lines, factor, systemFromFlag)
+
+	if recipePDFFlag {
+		outFile := recipeOutFlag
+		if outFile == "" {
+			outFile = strings.TrimSuffix(args[0], path.Ext(args[0])) + "_scaled.pdf"
+		}
+		if err := writeRecipePDF(scaled, outFile); err != nil {
+			return err
+		}
+		fmt.Printf("new file created at: %s\n", outFile)
+		return nil
+	}
+
+	md := strings.Join(scaled, "\n") + "\n"
+	if recipeOutFlag != "" {
+		return ioutil.WriteFile(recipeOutFlag, []byte(md), 0644)
+	}
+	fmt.Print(md)
+	return nil
+}
+
+// writeRecipePDF lays out the recipe on Letter pages, markdown headers are
+// printed in bold
+func writeRecipePDF(lines []string, outFile string) error {
+	pdf := gofpdf.New("P", "in", "Letter", "")
+	pdf.SetMargins(0.75, 0.75, 0.75)
+	pdf.SetAutoPageBreak(true, 0.75)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	for _, line := range lines {
+		style, size := "", 12.0
+		if strings.HasPrefix(line, "#") {
+			style, size = "B", 16.0
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		pdf.SetFont("courier", style, size)
+		pdf.MultiCell(0, size/60, tr(line), "", "L", false)
+	}
+	return pdf.OutputFileAndClose(outFile)
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIngredient(t *testing.T) {
+	cases := []struct {
+		line string
+		ok   bool
+		unit string
+		rest string
+	}{
+		{"1 1/2 cups flour", true, "cup", "flour"},
+		{"2 t salt", true, "teaspoon", "salt"},
+		{"1 T sugar", true, "tablespoon", "sugar"},
+		{"1 C milk", true, "cup", "milk"},
+		{"2 Tbsp. butter, melted", true, "tablespoon", "butter, melted"},
+		{"250 g butter", true, "g", "butter"},
+		{"3 eggs", true, "egg", ""},
+		{"2 lemons, juiced", true, "lemon", ", juiced"},
+		{"2 pinches salt", true, "", "pinches salt"},
+		{"1. Preheat oven to 350F", false, "", ""},
+		{"12. Serve", false, "", ""},
+		{"Mix well", false, "", ""},
+	}
+	for _, c := range cases {
+		ing, ok := parseIngredient(c.line)
+		if ok != c.ok {
+			t.Errorf("%q: parsed %v, expected %v", c.line, ok, c.ok)
+			continue
+		}
+		if ok && (ing.unit != c.unit || ing.rest != c.rest) {
+			t.Errorf("%q: got unit %q rest %q, expected %q %q", c.line, ing.unit, ing.rest, c.unit, c.rest)
+		}
+	}
+}
+
+func TestScaleRecipe(t *testing.T) {
+	in := `# Pancakes
+serves: 4
+
+* 1 cup flour
+  - 2 t baking powder
+1 C milk
+
+1. Preheat oven to 350F
+2. Mix and cook`
+	expected := `# Pancakes
+serves: 8
+
+* 2 cups flour
+  - 1 1/3 tbsp baking powder
+2 cups milk
+
+1. Preheat oven to 350F
+2. Mix and cook`
+	out := strings.Join(scaleRecipe(strings.Split(in, "\n"), 2, ""), "\n")
+	if out != expected {
+		t.Errorf("got\n%v\nexpected\n%v", out, expected)
+	}
+}
+
+func TestScaleRecipeSections(t *testing.T) {
+	in := `# Apple Pie
+## Ingredients
+3 apples
+1 C sugar
+### Crust
+2 eggs
+1 pinch salt
+## Directions
+20 minutes at 350F
+2 C cream, whipped
+
+Ingredients:
+2 onions
+Steps:
+10 minutes`
+	expected := `# Apple Pie
+## Ingredients
+6 apples
+2 cups sugar
+### Crust
+4 eggs
+2 pinch salt
+## Directions
+20 minutes at 350F
+4 cups cream, whipped
+
+Ingredients:
+4 onions
+Steps:
+10 minutes`
+	out := strings.Join(scaleRecipe(strings.Split(in, "\n"), 2, ""), "\n")
+	if out != expected {
+		t.Errorf("got\n%v\nexpected\n%v", out, expected)
+	}
+}
+
+func TestScaleRecipeSystems(t *testing.T) {
+	in := []string{"8 floz milk", "1 pint cream", "2 quarts stock", "1 gal water"}
+	cases := map[string][]string{
+		"":         {"1 cup milk", "2 cups cream", "8 cups stock", "19 1/4 cups water"},
+		"imperial": {"1 cup milk", "2 cups cream", "8 cups stock", "19 1/4 cups water"},
+		"metric":   {"237 mL milk", "473 mL cream", "1.89 L stock", "4.55 L water"},
+	}
+	for system, expected := range cases {
+		out := scaleRecipe(in, 1, system)
+		if strings.Join(out, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%q: got %q, expected %q", system, out, expected)
+		}
+	}
+}
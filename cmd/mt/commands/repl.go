@@ -0,0 +1,211 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+)
+
+// interactive calculator
+var (
+	ReplCmd = &cobra.Command{
+		Use:   "repl",
+		Short: "interactive calculator session with variables and history",
+		Long: `interactive calculator session with variables and history
+
+Lines are evaluated like "mt [expr]", variables may be assigned (x = 3 ft) and
+the previous result referenced as "ans". Functions: sqrt, abs, floor, ceil,
+round, exp, ln, log, log2, sin, cos, tan, asin, acos, atan.
+
+Each line is saved to $HOME/.multitool_history and replayed when the next
+session starts (unless --fresh). Commands:
+    :vars     list variables
+    :history  print the session history
+    :clear    clear variables and history
+    :quit     exit (also exit, quit, or ctrl-d)`,
+		Args: cobra.NoArgs,
+		RunE: replCmd,
+	}
+)
+
+var freshFromFlag bool
+
+func init() {
+	ReplCmd.PersistentFlags().BoolVar(&freshFromFlag, "fresh", false,
+		"start a new session instead of resuming from the history")
+	RootCmd.AddCommand(ReplCmd)
+}
+
+// calcSession holds the variables and history of a repl session
+type calcSession struct {
+	vars    map[string]quantity
+	history []string
+}
+
+func newCalcSession() *calcSession {
+	return &calcSession{vars: make(map[string]quantity)}
+}
+
+var assignmentRe = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9]*)\s*=(.*)$`)
+
+// eval evaluates a line, either an expression or an assignment, storing the
+// result as "ans"
+func (s *calcSession) eval(line string) (quantity, error) {
+	expr, name := line, ""
+	if match := assignmentRe.FindStringSubmatch(line); match != nil {
+		name, expr = match[1], match[2]
+		if _, found := calcFunctions[name]; found {
+			return quantity{}, fmt.Errorf("cannot assign to function %v", name)
+		}
+		if _, found := calcConstants[name]; found {
+			return quantity{}, fmt.Errorf("cannot assign to constant %v", name)
+		}
+		if _, found := knownUnit(name); found {
+			return quantity{}, fmt.Errorf("cannot assign to unit %v", name)
+		}
+		if name == "ans" {
+			return quantity{}, errors.New("cannot assign to ans, it holds the previous result")
+		}
+	}
+	q, err := evalUnitExprWithVars(expr, s.vars)
+	if err != nil {
+		return quantity{}, err
+	}
+	if name != "" {
+		s.vars[name] = q
+	}
+	s.vars["ans"] = q
+	s.history = append(s.history, strings.TrimSpace(line))
+	return q, nil
+}
+
+func (s *calcSession) printVars(w io.Writer) {
+	var names []string
+	for name := range s.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%v = %v\n", name, s.vars[name])
+	}
+}
+
+func historyPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".multitool_history"), nil
+}
+
+// resume replays the lines of a previous session, lines which no longer
+// evaluate are skipped
+func (s *calcSession) resume(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if _, err := s.eval(line); err == nil {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+func replCmd(cmd *cobra.Command, args []string) error {
+	histPath, err := historyPath()
+	if err != nil {
+		return err
+	}
+
+	session := newCalcSession()
+	if !freshFromFlag {
+		if f, err := os.Open(histPath); err == nil {
+			n, err := session.resume(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				fmt.Printf("resumed %d lines from %v\n", n, histPath)
+			}
+		}
+	} else if err := os.Remove(histPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	histFile, err := os.OpenFile(histPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer histFile.Close()
+
+	return session.run(os.Stdin, os.Stdout, histFile)
+}
+
+// run reads lines until the input ends or the session is quit, appending
+// each evaluated line to the history
+func (s *calcSession) run(in io.Reader, out io.Writer, hist io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		switch line {
+		case "":
+			continue
+		case ":quit", "exit", "quit":
+			return nil
+		case ":vars":
+			s.printVars(out)
+			continue
+		case ":history":
+			for _, h := range s.history {
+				fmt.Fprintln(out, h)
+			}
+			continue
+		case ":clear":
+			s.vars = make(map[string]quantity)
+			s.history = nil
+			if f, ok := hist.(*os.File); ok {
+				if err := f.Truncate(0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			fmt.Fprintf(out, "unknown command %v\n", line)
+			continue
+		}
+
+		q, err := s.eval(line)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		fmt.Fprintln(out, q)
+		if ud, ok := q.units.def(); ok && ud.dim[dimCurrency] != 0 {
+			fmt.Fprintln(out, ratesNote())
+		}
+		if _, err := fmt.Fprintln(hist, line); err != nil {
+			return err
+		}
+	}
+}
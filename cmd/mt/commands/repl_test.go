@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalcSessionAssign(t *testing.T) {
+	s := newCalcSession()
+	if _, err := s.eval("x = 3 ft"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"m = 5", "s = 2", "L = 3", "cups = 1", "ans = 4", "sqrt = 1"} {
+		if _, err := s.eval(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+	q, err := s.eval("x + 1 ft in m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(q.value.lo-1.2192) > 1e-9 || q.units.String() != "m" {
+		t.Errorf("got %v, expected 1.2192 m", q)
+	}
+}
+
+func TestCalcSessionVariables(t *testing.T) {
+	s := newCalcSession()
+	if _, err := s.eval("total2 = 3"); err != nil {
+		t.Fatal(err)
+	}
+	q, err := s.eval("total2 * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.value.lo != 6 {
+		t.Errorf("got %v, expected 6", q)
+	}
+
+	// names the calculator can't read back can't be assigned
+	if _, err := s.eval("my_var = 3"); err == nil {
+		t.Error("my_var: expected an error")
+	}
+	if _, found := s.vars["my_var"]; found {
+		t.Error("my_var was stored")
+	}
+}
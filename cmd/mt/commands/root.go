@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,16 +11,60 @@ import (
 	"github.com/spf13/viper"
 )
 
-var cfgFile string
+var (
+	cfgFile         string
+	intModeFromFlag bool
+	basesFromFlag   string
+)
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "mt [expr]",
 	Short: "multitool, a collection of handy lil tools",
-	Args:  cobra.ArbitraryArgs,
+	Long: `multitool, a collection of handy lil tools
+
+When called with an expression it is evaluated as math, quantities may carry
+units and be converted with "in" or "to", ex:
+    mt 3 cups + 200 mL in L
+    mt (12 ft * 9 ft) to m^2
+
+Integer expressions are calculated with arbitrary precision, as are
+expressions using 0x, 0b or 0o literals or the bitwise operators
+& | xor ~ << >> (where ^ and ** are exponentiation), ex:
+    mt 2^64
+    mt --bases all '0xff00 | 0b1010'`,
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		// First attempt to calculate like math
+		// Integers and programmer expressions are calculated precisely, a
+		// fractional result of an integer expression is printed as a decimal.
+		// Expressions with ^ never fall through as it's xor to govaluate.
+		intExpr := strings.Join(args, " ")
+		programmer := intModeFromFlag || isProgrammerExpr(intExpr)
+		if programmer || isIntegerExpr(intExpr) {
+			res, err := evalIntExpr(intExpr)
+			if err != nil && (programmer || strings.Contains(intExpr, "^")) {
+				return err
+			}
+			if err == nil {
+				if !programmer && !res.IsInt() {
+					fmt.Println(ratDecimal(res))
+					return nil
+				}
+				bases, err := parseBases(basesFromFlag)
+				if err != nil {
+					return err
+				}
+				out, err := formatIntResult(res, bases)
+				if err != nil {
+					return err
+				}
+				fmt.Println(out)
+				return nil
+			}
+		}
+
+		// Next attempt to calculate like math
 		var mathErr error
 		argsJoined := strings.Join(args, "")
 		amountExpr, err := govaluate.NewEvaluableExpression(argsJoined)
@@ -47,7 +90,16 @@ var RootCmd = &cobra.Command{
 			}
 		}
 
-		return errors.New("could not resolve command")
+		// Finally attempt to calculate with units
+		q, err := evalUnitExpr(strings.Join(args, " "))
+		if err != nil {
+			return fmt.Errorf("could not resolve command: %v", err)
+		}
+		fmt.Println(q)
+		if ud, ok := q.units.def(); ok && ud.dim[dimCurrency] != 0 {
+			fmt.Println(ratesNote())
+		}
+		return nil
 	},
 }
 
@@ -71,7 +123,10 @@ func init() {
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
-	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	RootCmd.Flags().BoolVarP(&intModeFromFlag, "int", "i", false,
+		"calculate with arbitrary precision integers and fractions")
+	RootCmd.Flags().StringVarP(&basesFromFlag, "bases", "b", "",
+		"also print integer results in these bases, ex. 2,8,16 or all")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -98,4 +153,13 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
+
+	// register any units and materials defined in the config, along with
+	// currencies from the exchange rates file
+	if err := loadConfigUnits(); err != nil {
+		fmt.Println(err)
+	}
+	if err := loadCurrencyRates(); err != nil {
+		fmt.Println(err)
+	}
 }
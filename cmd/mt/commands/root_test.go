@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRootCalc(t *testing.T) {
+	cases := map[string]string{
+		"2^-2":  "0.25",
+		"3^2/2": "4.5",
+		"2^64":  "18446744073709551616",
+		"1/3":   "0.33333333333333333333",
+	}
+	for expr, expected := range cases {
+		var err error
+		out := withStdio(t, "", func() { err = RootCmd.RunE(RootCmd, []string{expr}) })
+		if err != nil {
+			t.Errorf("%v: %v", expr, err)
+		} else if got := strings.TrimSpace(out); got != expected {
+			t.Errorf("%v: got %v, expected %v", expr, got, expected)
+		}
+	}
+
+	// powers which can't be calculated exactly aren't passed on as xor
+	if err := RootCmd.RunE(RootCmd, []string{"2^1000000"}); err == nil {
+		t.Error("2^1000000: expected an error")
+	}
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	cryptorand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// secrets such as otp keys are kept in files encrypted with AES-256-GCM
+// under a key derived from a passphrase with argon2id, the passphrase is
+// prompted for or read from $MT_PASSPHRASE
+
+const passphraseEnv = "MT_PASSPHRASE"
+
+// argon2id parameters of new files, the second recommendation of RFC 9106
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// sealedData is the json written to an encrypted file, the kdf parameters
+// are stored so that they may change without breaking existing files
+type sealedData struct {
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// secretFile is a passphrase encrypted file, the passphrase is asked for at
+// most once per command
+type secretFile struct {
+	path       string
+	passphrase []byte
+}
+
+// newSecretFile opens the file at the path, or at the default file name
+// within the home directory
+func newSecretFile(path, defaultName string) (*secretFile, error) {
+	if path == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, err
+		}
+		return &secretFile{path: filepath.Join(home, defaultName)}, nil
+	}
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	return &secretFile{path: path}, nil
+}
+
+func (f *secretFile) exists() bool {
+	_, err := os.Stat(f.path)
+	return err == nil
+}
+
+// stdinLines is shared so that buffered input isn't lost between reads
+var stdinLines = bufio.NewReader(os.Stdin)
+
+// readHidden reads a line from the terminal without echo, or otherwise a
+// line of stdin
+func readHidden(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		line, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return line, err
+	}
+	line, err := stdinLines.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("error reading input: %v", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// readPassphrase reads the passphrase from the environment or as hidden
+// input
+func readPassphrase(prompt string) ([]byte, error) {
+	if pass := os.Getenv(passphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+	return readHidden(prompt)
+}
+
+// unlock asks for the passphrase, twice for a new file
+func (f *secretFile) unlock() error {
+	if f.passphrase != nil {
+		return nil
+	}
+	if f.exists() {
+		pass, err := readPassphrase(fmt.Sprintf("passphrase for %v: ", f.path))
+		if err != nil {
+			return err
+		}
+		f.passphrase = pass
+		return nil
+	}
+
+	pass, err := readPassphrase(fmt.Sprintf("new passphrase for %v: ", f.path))
+	if err != nil {
+		return err
+	}
+	if len(pass) == 0 {
+		return errors.New("the passphrase can't be empty")
+	}
+	if os.Getenv(passphraseEnv) == "" {
+		confirm, err := readPassphrase("confirm passphrase: ")
+		if err != nil {
+			return err
+		}
+		if string(confirm) != string(pass) {
+			return errors.New("the passphrases don't match")
+		}
+	}
+	f.passphrase = pass
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// load decrypts the file into v, a missing file leaves v untouched
+func (f *secretFile) load(v interface{}) error {
+	bz, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var sealed sealedData
+	if err := json.Unmarshal(bz, &sealed); err != nil {
+		return fmt.Errorf("%v isn't an encrypted file: %v", f.path, err)
+	}
+	if sealed.KDF != "argon2id" {
+		return fmt.Errorf("unknown kdf %v in %v", sealed.KDF, f.path)
+	}
+	if err := f.unlock(); err != nil {
+		return err
+	}
+
+	key := argon2.IDKey(f.passphrase, sealed.Salt, sealed.Time, sealed.Memory, sealed.Threads, argonKeyLen)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(sealed.Nonce) != gcm.NonceSize() {
+		return fmt.Errorf("bad nonce in %v", f.path)
+	}
+	plain, err := gcm.Open(nil, sealed.Nonce, sealed.Data, []byte(sealed.KDF))
+	if err != nil {
+		return fmt.Errorf("wrong passphrase or %v has been tampered with", f.path)
+	}
+	return json.Unmarshal(plain, v)
+}
+
+// save encrypts v with a new salt and nonce, replacing the file
+func (f *secretFile) save(v interface{}) error {
+	if err := f.unlock(); err != nil {
+		return err
+	}
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	sealed := sealedData{
+		KDF:     "argon2id",
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+		Salt:    make([]byte, argonSaltLen),
+	}
+	if _, err := cryptorand.Read(sealed.Salt); err != nil {
+		return fmt.Errorf("error reading random: %v", err)
+	}
+	key := argon2.IDKey(f.passphrase, sealed.Salt, sealed.Time, sealed.Memory, sealed.Threads, argonKeyLen)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	sealed.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := cryptorand.Read(sealed.Nonce); err != nil {
+		return fmt.Errorf("error reading random: %v", err)
+	}
+	sealed.Data = gcm.Seal(nil, sealed.Nonce, plain, []byte(sealed.KDF))
+
+	bz, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write alongside then rename so a failed write can't lose the secrets
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bz, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
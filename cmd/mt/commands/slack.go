@@ -1,54 +1,122 @@
 package commands
 
 import (
-	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
-	"github.com/atotto/clipboard"
 	"github.com/spf13/cobra"
 )
 
+var slackIO textIO
+
 func init() {
+	addTranscriptFlags(SlackCmd, &slackIO)
 	RootCmd.AddCommand(SlackCmd)
 }
 
-// Lock2yamlCmd represents the lock2yaml command
+// SlackCmd is an alias of "chat clean --from slack"
 var SlackCmd = &cobra.Command{
 	Use:   "slack [names...]",
-	Short: "From/to clipboard - slack text, delete extra lines and timestamps",
+	Short: "From/to clipboard - slack text as a markdown, text or json transcript",
+	Long: `From/to clipboard - slack text as a markdown, text or json transcript
+
+Alias of "mt chat clean --from slack". The text may instead be read from and
+written to files or stdin/stdout with --in and --out, which is the default
+where there's no clipboard.
+
+Speakers are detected from the lines slack places before their messages
+(ex. "Jane Doe  10:32 AM" or "Jane Doe [10:32 AM]"), names may also be
+provided for speakers whose lines have no time. Edited markers, reactions,
+thread reply counts and emoji shortcodes are recognized.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		return cleanChat("slack", slackIO, args)
+	},
+}
 
-		// get the text
-		text, err := clipboard.ReadAll()
-		if err != nil {
-			return err
-		}
+const slackTime = `\d{1,2}:\d{2}(?:\s?[AaPp][Mm])?`
 
-		//delete timestamps
-		re := regexp.MustCompile(`\[(\d|\d\d)\:\d\d(|\s[A-Z]{2})\]`)
-		text = re.ReplaceAllString(text, "")
+var (
+	// speaker lines, the name followed by the time in brackets or after a
+	// wide space
+	slackSpeakerRe = regexp.MustCompile(`^(\S.{0,60}?)(?:\s*\[(` + slackTime + `)\]|\s{2,}(` + slackTime + `))$`)
 
-		//delete blank lines
-		re = regexp.MustCompile(`(?m)^\s*$[\r\n]*|[\r\n]+\s+\z`)
-		text = re.ReplaceAllString(text, "")
+	// continuation messages of the previous speaker start with a time in
+	// brackets or have the time alone on its line, so that messages starting
+	// with a time ("10:30 works for me") aren't split
+	slackContinuedRe = regexp.MustCompile(`^(?:\[(` + slackTime + `)\](?:\s+(.*))?|(` + slackTime + `))$`)
 
-		//delete all @ symbols
-		text = strings.Replace(text, "@", "", -1)
+	slackThreadRe   = regexp.MustCompile(`^(\S.{0,60}?) replied to a thread: (.*)$`)
+	slackRepliesRe  = regexp.MustCompile(`^(\d+) repl(?:y|ies)$`)
+	slackReactionRe = regexp.MustCompile(`^((?::[a-z0-9_+\-]+:\s*)+)(\d+)?$`)
+	slackCountRe    = regexp.MustCompile(`^\d+$`)
 
-		//Add a space for all names, make the name bold
-		for _, arg := range args {
-			text = strings.Replace(text, "\n"+arg+"\n", "\n\n**"+arg+"**\n", -1)
-			text = strings.Replace(text, "\n"+arg+" \n", "\n\n**"+arg+"**\n", -1)
-			text = strings.Replace(text, "\n"+arg+"  \n", "\n\n**"+arg+"**\n", -1)
-		}
+	// lines of the slack interface rather than of messages
+	slackNoiseRe = regexp.MustCompile(`^(?:Today|Yesterday|New|New messages|View thread|Show more|` +
+		`Last reply .*|(?:Mon|Tues|Wednes|Thurs|Fri|Satur|Sun)day, \w+ \d{1,2}(?:st|nd|rd|th)?)$`)
+)
 
-		err = clipboard.WriteAll(text)
-		if err != nil {
-			return err
-		}
+// parseSlack parses text copied from slack, names are additional speakers
+// which may appear on a line of their own
+func parseSlack(text string, names []string) []chatMessage {
+	isName := make(map[string]bool)
+	for _, name := range names {
+		isName[name] = true
+	}
 
-		fmt.Println("Processed successfully")
-		return nil
-	},
+	var t transcript
+	speaker := ""
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		cur := t.last()
+		switch {
+		case line == "" || slackNoiseRe.MatchString(line):
+			continue
+
+		case line == "(edited)":
+			if cur != nil {
+				cur.Edited = true
+			}
+
+		case isName[line]:
+			speaker = line
+			t.start(speaker, "", "")
+
+		case slackSpeakerRe.MatchString(line):
+			m := slackSpeakerRe.FindStringSubmatch(line)
+			speaker = strings.TrimPrefix(m[1], "@")
+			t.start(speaker, m[2]+m[3], "")
+
+		case slackContinuedRe.MatchString(line):
+			m := slackContinuedRe.FindStringSubmatch(line)
+			t.start(speaker, m[1]+m[3], m[2])
+
+		case slackThreadRe.MatchString(line):
+			m := slackThreadRe.FindStringSubmatch(line)
+			speaker = m[1]
+			t.start(speaker, "", m[2]).Thread = true
+
+		case slackRepliesRe.MatchString(line) && cur != nil:
+			cur.Replies, _ = strconv.Atoi(slackRepliesRe.FindStringSubmatch(line)[1])
+
+		case slackReactionRe.MatchString(line) && cur != nil:
+			// the count is on the same line or the following one
+			m := slackReactionRe.FindStringSubmatch(line)
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			} else if i+1 < len(lines) && slackCountRe.MatchString(strings.TrimSpace(lines[i+1])) {
+				i++
+				count, _ = strconv.Atoi(strings.TrimSpace(lines[i]))
+			}
+			for _, code := range chatShortcodeRe.FindAllString(m[1], -1) {
+				cur.Reactions = append(cur.Reactions, reaction{expandEmoji(code), count})
+			}
+
+		default:
+			t.addText(line)
+		}
+	}
+	return t.messages()
 }
@@ -0,0 +1,30 @@
+package commands
+
+import "testing"
+
+func TestParseSlackContinued(t *testing.T) {
+	in := `Jane Doe  10:32 AM
+when should we meet?
+Bob Smith  10:33 AM
+10:30 works for me
+9:00 standup moved though
+10:34
+see you then
+[10:35] bring coffee`
+	expected := []chatMessage{
+		{Speaker: "Jane Doe", Time: "10:32 AM", Text: "when should we meet?"},
+		{Speaker: "Bob Smith", Time: "10:33 AM", Text: "10:30 works for me\n9:00 standup moved though"},
+		{Speaker: "Bob Smith", Time: "10:34", Text: "see you then"},
+		{Speaker: "Bob Smith", Time: "10:35", Text: "bring coffee"},
+	}
+	msgs := parseSlack(in, nil)
+	if len(msgs) != len(expected) {
+		t.Fatalf("got %d messages, expected %d: %+v", len(msgs), len(expected), msgs)
+	}
+	for i, m := range msgs {
+		e := expected[i]
+		if m.Speaker != e.Speaker || m.Time != e.Time || m.Text != e.Text {
+			t.Errorf("message %d: got %+v, expected %+v", i, m, e)
+		}
+	}
+}
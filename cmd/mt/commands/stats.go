@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// descriptive statistics
+var (
+	StatsCmd = &cobra.Command{
+		Use:   "stats [file]",
+		Short: "descriptive statistics of a list of numbers",
+		Long: `descriptive statistics of a list of numbers
+
+Numbers are read from the file (or stdin when no file or "-" is provided)
+separated by whitespace or commas, values which aren't numbers (such as a
+heading) are skipped. With --col the input is read as CSV and only the
+column is used, the column may be a header name or an index from 1, ex:
+    pbpaste | mt stats
+    mt stats --col price sales.csv`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: statsCmd,
+	}
+)
+
+var (
+	statsColFromFlag   string
+	statsBinsFromFlag  int
+	statsWidthFromFlag int
+)
+
+func init() {
+	StatsCmd.PersistentFlags().StringVarP(&statsColFromFlag, "col", "c", "",
+		"read the input as CSV using this column (by name or index from 1)")
+	StatsCmd.PersistentFlags().IntVar(&statsBinsFromFlag, "bins", 10,
+		"number of histogram bins, 0 for no histogram")
+	StatsCmd.PersistentFlags().IntVar(&statsWidthFromFlag, "width", 40,
+		"width of the largest histogram bar")
+	RootCmd.AddCommand(StatsCmd)
+}
+
+func statsCmd(cmd *cobra.Command, args []string) error {
+	if statsBinsFromFlag < 0 {
+		return fmt.Errorf("bad number of bins %d", statsBinsFromFlag)
+	}
+	if statsWidthFromFlag <= 0 {
+		return fmt.Errorf("bad histogram width %d, must be positive", statsWidthFromFlag)
+	}
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	}
+	in, err := openCSVFile(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var vals []float64
+	var skipped int
+	if statsColFromFlag != "" {
+		vals, skipped, err = readCSVColumnNumbers(in, statsColFromFlag)
+	} else {
+		vals, skipped, err = readNumbers(in)
+	}
+	if err != nil {
+		return err
+	}
+	if len(vals) == 0 {
+		return fmt.Errorf("no numbers found")
+	}
+
+	fmt.Print(describe(vals))
+	if statsBinsFromFlag > 0 {
+		fmt.Println()
+		fmt.Print(histogram(vals, statsBinsFromFlag, statsWidthFromFlag))
+	}
+	if skipped > 0 {
+		fmt.Printf("\nskipped %d values which aren't numbers\n", skipped)
+	}
+	return nil
+}
+
+// parseStatNumber parses a number allowing for a leading currency sign and a
+// trailing percent
+func parseStatNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimSuffix(s, "%")
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// readNumbers reads all the numbers separated by whitespace or commas,
+// counting the values which are skipped
+func readNumbers(r io.Reader) (vals []float64, skipped int, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t'
+		})
+		for _, field := range fields {
+			if v, ok := parseStatNumber(field); ok {
+				vals = append(vals, v)
+			} else {
+				skipped++
+			}
+		}
+	}
+	return vals, skipped, scanner.Err()
+}
+
+// readCSVColumnNumbers reads the numbers of a CSV column, the first row is
+// the header
+func readCSVColumnNumbers(r io.Reader, col string) (vals []float64, skipped int, err error) {
+	reader := newCSVReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	idx, err := csvColumnIndex(header, col)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if idx >= len(record) {
+			skipped++
+			continue
+		}
+		if v, ok := parseStatNumber(record[idx]); ok {
+			vals = append(vals, v)
+		} else {
+			skipped++
+		}
+	}
+	return vals, skipped, nil
+}
+
+// percentile of sorted values, interpolating between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+// describe prints the count, sum, mean, sample standard deviation, and
+// percentiles of the values
+func describe(vals []float64) string {
+	sorted := append([]float64{}, vals...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+	}
+	mean := sum / float64(len(vals))
+	variance := 0.0
+	for _, v := range vals {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := 0.0
+	if len(vals) > 1 {
+		stddev = math.Sqrt(variance / float64(len(vals)-1))
+	}
+
+	rows := []struct {
+		name string
+		val  string
+	}{
+		{"count", strconv.Itoa(len(vals))},
+		{"sum", formatAmount(sum)},
+		{"mean", formatAmount(mean)},
+		{"stddev", formatAmount(stddev)},
+		{"min", formatAmount(sorted[0])},
+		{"p25", formatAmount(percentile(sorted, 25))},
+		{"median", formatAmount(percentile(sorted, 50))},
+		{"p75", formatAmount(percentile(sorted, 75))},
+		{"p90", formatAmount(percentile(sorted, 90))},
+		{"p95", formatAmount(percentile(sorted, 95))},
+		{"p99", formatAmount(percentile(sorted, 99))},
+		{"max", formatAmount(sorted[len(sorted)-1])},
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "%-7v %v\n", row.name, row.val)
+	}
+	return sb.String()
+}
+
+// histogram draws a bar for each of the equal width bins between the
+// minimum and maximum values
+func histogram(vals []float64, bins, width int) string {
+	min, max := vals[0], vals[0]
+	for _, v := range vals {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	if min == max {
+		bins = 1
+	}
+	binWidth := (max - min) / float64(bins)
+
+	counts := make([]int, bins)
+	for _, v := range vals {
+		i := bins - 1
+		if binWidth > 0 {
+			i = int((v - min) / binWidth)
+		}
+		if i >= bins { // the maximum falls in the last bin
+			i = bins - 1
+		}
+		counts[i]++
+	}
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+
+	labels := make([]string, bins)
+	labelWidth := 0
+	for i := range counts {
+		lo := min + float64(i)*binWidth
+		hi := lo + binWidth
+		labels[i] = fmt.Sprintf("%v – %v", formatAmount(lo), formatAmount(hi))
+		if n := len([]rune(labels[i])); n > labelWidth {
+			labelWidth = n
+		}
+	}
+
+	var sb strings.Builder
+	for i, c := range counts {
+		bar := int(math.Round(float64(c) / float64(most) * float64(width)))
+		pad := strings.Repeat(" ", labelWidth-len([]rune(labels[i])))
+		fmt.Fprintf(&sb, "%v%v | %v %d\n", labels[i], pad, strings.Repeat("#", bar), c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsFlagValidation(t *testing.T) {
+	defer func(bins, width int) {
+		statsBinsFromFlag, statsWidthFromFlag = bins, width
+	}(statsBinsFromFlag, statsWidthFromFlag)
+
+	for _, c := range []struct{ bins, width int }{{-1, 40}, {10, 0}, {10, -5}} {
+		statsBinsFromFlag, statsWidthFromFlag = c.bins, c.width
+		if err := statsCmd(nil, []string{"missing.csv"}); err == nil ||
+			strings.Contains(err.Error(), "missing.csv") {
+			t.Errorf("bins %d width %d: expected a flag error, got %v", c.bins, c.width, err)
+		}
+	}
+}
+
+func TestReadCSVColumnNumbers(t *testing.T) {
+	defer func(comma rune) { csvComma = comma }(csvComma)
+	csvComma = ';'
+	in := "name;price\na;1.5\nb;2\nc;n/a\n"
+	vals, skipped, err := readCSVColumnNumbers(strings.NewReader(in), "price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 2 || skipped != 1 {
+		t.Errorf("got %v with %d skipped", vals, skipped)
+	}
+}
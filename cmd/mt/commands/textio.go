@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/spf13/cobra"
+)
+
+// commands which read or write the clipboard instead accept --in and --out
+// as a file, "-" for stdin/stdout, or "clipboard", where no clipboard is
+// available or it fails (such as xclip without a display) stdin/stdout is used
+
+const (
+	ioClipboard = "clipboard"
+	ioStdio     = "-"
+)
+
+// clipboardBackend is the clipboard used by textIO
+type clipboardBackend interface {
+	ReadAll() (string, error)
+	WriteAll(text string) error
+	Available() bool
+}
+
+// systemClipboard is the clipboard of the desktop
+type systemClipboard struct{}
+
+func (systemClipboard) ReadAll() (string, error)   { return clipboard.ReadAll() }
+func (systemClipboard) WriteAll(text string) error { return clipboard.WriteAll(text) }
+func (systemClipboard) Available() bool            { return !clipboard.Unsupported }
+
+// memClipboard is an in-memory clipboard which may stand in for the system
+// clipboard, such as within tests
+type memClipboard struct {
+	text string
+}
+
+func (c *memClipboard) ReadAll() (string, error)   { return c.text, nil }
+func (c *memClipboard) WriteAll(text string) error { c.text = text; return nil }
+func (c *memClipboard) Available() bool            { return true }
+
+var activeClipboard clipboardBackend = systemClipboard{}
+
+// clipboardFailed is set once the clipboard has failed, the rest of the
+// command then uses stdin/stdout
+var clipboardFailed bool
+
+// clipboardFallback notes the clipboard failure on stderr
+func clipboardFallback(err error, to string) {
+	clipboardFailed = true
+	fmt.Fprintf(os.Stderr, "clipboard unavailable (%v), using %v\n", err, to)
+}
+
+// textIO is the input and output of a command set by --in and --out
+type textIO struct {
+	in, out string
+}
+
+// addTextIOFlags registers --out, and --in if the command reads input
+func addTextIOFlags(cmd *cobra.Command, tio *textIO, withInput bool) {
+	if withInput {
+		cmd.PersistentFlags().StringVar(&tio.in, "in", ioClipboard,
+			"read from a file, - for stdin, or clipboard")
+	}
+	cmd.PersistentFlags().StringVar(&tio.out, "out", ioClipboard,
+		"write to a file, - for stdout, or clipboard")
+}
+
+// resolve falls back to stdio where there's no clipboard
+func resolveIO(target string) string {
+	if target == "" || (target == ioClipboard && (clipboardFailed || !activeClipboard.Available())) {
+		return ioStdio
+	}
+	return target
+}
+
+func (t textIO) read() (string, error) {
+	switch in := resolveIO(t.in); in {
+	case ioClipboard:
+		text, err := activeClipboard.ReadAll()
+		if err == nil {
+			return text, nil
+		}
+		clipboardFallback(err, "stdin")
+		fallthrough
+	case ioStdio:
+		bz, err := ioutil.ReadAll(os.Stdin)
+		return string(bz), err
+	default:
+		bz, err := ioutil.ReadFile(in)
+		return string(bz), err
+	}
+}
+
+func (t textIO) write(text string) error {
+	switch out := resolveIO(t.out); out {
+	case ioClipboard:
+		err := activeClipboard.WriteAll(text)
+		if err == nil {
+			return nil
+		}
+		clipboardFallback(err, "stdout")
+		fallthrough
+	case ioStdio:
+		_, err := fmt.Fprintln(os.Stdout, text)
+		return err
+	default:
+		return ioutil.WriteFile(out, []byte(text), 0600)
+	}
+}
+
+// destination describes where the output was written
+func (t textIO) destination() string {
+	switch out := resolveIO(t.out); out {
+	case ioClipboard:
+		return "clipboard"
+	case ioStdio:
+		return "stdout"
+	default:
+		return out
+	}
+}
+
+// status prints a message about the command, to stderr when the output is
+// stdout so the output isn't mixed with it
+func (t textIO) status(format string, args ...interface{}) {
+	w := os.Stdout
+	if resolveIO(t.out) == ioStdio {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format+"\n", args...)
+}
+
+// clearAfter clears the clipboard once the duration has passed, or sooner
+// on an interrupt, unless the text has since been replaced
+func (t textIO) clearAfter(text string, d time.Duration) error {
+	if d <= 0 || resolveIO(t.out) != ioClipboard {
+		return nil
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	select {
+	case <-time.After(d):
+	case <-sig:
+	}
+
+	cur, err := activeClipboard.ReadAll()
+	if err != nil {
+		return err
+	}
+	if cur != text {
+		return nil
+	}
+	if err := activeClipboard.WriteAll(""); err != nil {
+		return err
+	}
+	t.status("clipboard cleared")
+	return nil
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// failingClipboard is a clipboard which reports itself available but fails,
+// as xclip does without a display
+type failingClipboard struct{}
+
+func (failingClipboard) ReadAll() (string, error)   { return "", errors.New("no display") }
+func (failingClipboard) WriteAll(text string) error { return errors.New("no display") }
+func (failingClipboard) Available() bool            { return true }
+
+// withClipboard runs fn with the clipboard swapped out
+func withClipboard(t *testing.T, cb clipboardBackend, fn func()) {
+	t.Helper()
+	defer func(prev clipboardBackend) {
+		activeClipboard, clipboardFailed = prev, false
+	}(activeClipboard)
+	activeClipboard, clipboardFailed = cb, false
+	fn()
+}
+
+// withStdio runs fn with stdin holding the input, returning what fn wrote to
+// stdout
+func withStdio(t *testing.T, input string, fn func()) string {
+	t.Helper()
+	in, err := ioutil.TempFile("", "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(in.Name())
+	in.WriteString(input)
+	in.Seek(0, 0)
+	out, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+
+	defer func(stdin, stdout *os.File) { os.Stdin, os.Stdout = stdin, stdout }(os.Stdin, os.Stdout)
+	os.Stdin, os.Stdout = in, out
+	fn()
+	bz, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bz)
+}
+
+func TestTextIOClipboard(t *testing.T) {
+	cb := &memClipboard{text: "copied"}
+	withClipboard(t, cb, func() {
+		tio := textIO{in: ioClipboard, out: ioClipboard}
+		text, err := tio.read()
+		if err != nil || text != "copied" {
+			t.Fatalf("read %q, %v", text, err)
+		}
+		if err := tio.write("cleaned"); err != nil {
+			t.Fatal(err)
+		}
+		if cb.text != "cleaned" {
+			t.Errorf("clipboard holds %q", cb.text)
+		}
+		if d := tio.destination(); d != "clipboard" {
+			t.Errorf("destination %v", d)
+		}
+	})
+}
+
+func TestTextIOFallback(t *testing.T) {
+	withClipboard(t, failingClipboard{}, func() {
+		tio := textIO{in: ioClipboard, out: ioClipboard}
+		var text string
+		out := withStdio(t, "from stdin", func() {
+			var err error
+			if text, err = tio.read(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tio.write("to stdout"); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if text != "from stdin" {
+			t.Errorf("read %q", text)
+		}
+		if out != "to stdout\n" {
+			t.Errorf("wrote %q", out)
+		}
+		if d := tio.destination(); d != "stdout" {
+			t.Errorf("destination %v", d)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// embed the time zone database so conversions work offline
+	_ "time/tzdata"
+)
+
+// layouts accepted for the time of a time zone conversion, those without a
+// date are taken as today within the source zone
+var (
+	clockLayouts = []string{"15:04", "15:04:05", "3:04pm", "3:04PM", "3pm", "3PM"}
+	dateLayouts  = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+)
+
+// parseZonedTime parses the time within the location
+func parseZonedTime(s string, loc *time.Location) (time.Time, bool) {
+	if strings.ToLower(s) == "now" {
+		return time.Now().In(loc), true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	now := time.Now().In(loc)
+	for _, layout := range clockLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(),
+				t.Hour(), t.Minute(), t.Second(), 0, loc), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// convertTimeZone converts a time between time zones, ex.
+//
+//	14:00 America/Toronto to Europe/Berlin
+//
+// returning false if the args are not a time zone conversion
+func convertTimeZone(args []string) (bool, error) {
+	if len(args) != 4 {
+		return false, nil
+	}
+	fromLoc, err := time.LoadLocation(args[1])
+	if err != nil {
+		return false, nil
+	}
+	toLoc, err := time.LoadLocation(args[3])
+	if err != nil {
+		return false, nil
+	}
+	t, ok := parseZonedTime(args[0], fromLoc)
+	if !ok {
+		return true, fmt.Errorf("could not parse time %v, ex. 14:00 or 2006-01-02T15:04", args[0])
+	}
+
+	converted := t.In(toLoc)
+	layout := "15:04 Mon 2006-01-02 MST"
+	dayShift := ""
+	fromDate := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(converted.Year(), converted.Month(), converted.Day(), 0, 0, 0, 0, time.UTC)
+	if days := int(toDate.Sub(fromDate).Hours() / 24); days != 0 {
+		dayShift = fmt.Sprintf(" (%+d day)", days)
+	}
+	fmt.Printf("%v %v\n", t.Format(layout), fromLoc)
+	fmt.Printf("%v %v%v\n", converted.Format(layout), toLoc, dayShift)
+	return true, nil
+}
@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// dimension is the power of each base quantity which makes up a unit, the SI
+// base quantities along with currency
+type dimension [numBaseDims]int
+
+// base quantities
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimTemperature
+	dimCurrent
+	dimAmount
+	dimLuminosity
+	dimCurrency
+	numBaseDims
+)
+
+var (
+	dimNone        = dimension{}
+	dimLen         = dimension{dimLength: 1}
+	dimArea        = dimension{dimLength: 2}
+	dimVolume      = dimension{dimLength: 3}
+	dimWeight      = dimension{dimMass: 1}
+	dimDuration    = dimension{dimTime: 1}
+	dimTemp        = dimension{dimTemperature: 1}
+	dimFrequency   = dimension{dimTime: -1}
+	dimSpeed       = dimension{dimLength: 1, dimTime: -1}
+	dimForce       = dimension{dimLength: 1, dimMass: 1, dimTime: -2}
+	dimEnergy      = dimension{dimLength: 2, dimMass: 1, dimTime: -2}
+	dimPower       = dimension{dimLength: 2, dimMass: 1, dimTime: -3}
+	dimPressure    = dimension{dimLength: -1, dimMass: 1, dimTime: -2}
+	dimElecCurrent = dimension{dimCurrent: 1}
+	dimSubstance   = dimension{dimAmount: 1}
+	dimLuminous    = dimension{dimLuminosity: 1}
+	dimMoney       = dimension{dimCurrency: 1}
+)
+
+func (d dimension) mul(d2 dimension, n int) dimension {
+	for i := range d {
+		d[i] += n * d2[i]
+	}
+	return d
+}
+
+// unitDef defines a unit by its dimension and its relation to the SI base
+// units, an amount in SI = amount*factor + offset
+type unitDef struct {
+	name   string
+	dim    dimension
+	factor float64
+	offset float64
+}
+
+func (u unitDef) toSI(amount float64) float64   { return amount*u.factor + u.offset }
+func (u unitDef) fromSI(amount float64) float64 { return (amount - u.offset) / u.factor }
+
+// pow raises a unit to an integer power, ex. ft -> ft^2
+func (u unitDef) pow(n int) unitDef {
+	return unitDef{
+		name:   u.name + "^" + strconv.Itoa(n),
+		dim:    dimNone.mul(u.dim, n),
+		factor: math.Pow(u.factor, float64(n)),
+	}
+}
+
+// SI prefixes applied to units defined as prefixable
+var siPrefixes = map[string]float64{
+	"G":  1e9,
+	"M":  1e6,
+	"k":  1e3,
+	"h":  1e2,
+	"da": 1e1,
+	"d":  1e-1,
+	"c":  1e-2,
+	"m":  1e-3,
+	"u":  1e-6,
+	"µ":  1e-6,
+	"n":  1e-9,
+}
+
+// each unit is defined once, inverses and prefixed units are derived
+var unitDefs = []struct {
+	name       string
+	dim        dimension
+	factor     float64
+	offset     float64
+	prefixable bool
+}{
+	// length
+	{"m", dimLen, 1, 0, true},
+	{"in", dimLen, 0.0254, 0, false},
+	{"ft", dimLen, 0.3048, 0, false},
+	{"yd", dimLen, 0.9144, 0, false},
+	{"mi", dimLen, 1609.344, 0, false},
+
+	// area
+	{"acre", dimArea, 4046.8564224, 0, false},
+	{"hectare", dimArea, 1e4, 0, false},
+
+	// volume
+	{"L", dimVolume, 1e-3, 0, true},
+	{"gal", dimVolume, 4.54609e-3, 0, false},
+	{"quart", dimVolume, 4 * 0.236587524e-3, 0, false},
+	{"pint", dimVolume, 2 * 0.236587524e-3, 0, false},
+	{"cup", dimVolume, 0.236587524e-3, 0, false},
+	{"floz", dimVolume, 0.236587524e-3 / 8, 0, false},
+	{"tablespoon", dimVolume, 0.236587524e-3 / 16, 0, false},
+	{"teaspoon", dimVolume, 0.236587524e-3 / 48, 0, false},
+
+	// mass
+	{"g", dimWeight, 1e-3, 0, true},
+	{"t", dimWeight, 1e3, 0, false},
+	{"pound", dimWeight, 0.45359237, 0, false},
+	{"oz", dimWeight, 0.028349523125, 0, false},
+
+	// time
+	{"s", dimDuration, 1, 0, true},
+	{"min", dimDuration, 60, 0, false},
+	{"hr", dimDuration, 3600, 0, false},
+	{"day", dimDuration, 86400, 0, false},
+	{"week", dimDuration, 604800, 0, false},
+	{"Hz", dimFrequency, 1, 0, true},
+
+	// temperature
+	{"K", dimTemp, 1, 0, false},
+	{"C", dimTemp, 1, 273.15, false},
+	{"F", dimTemp, 5.0 / 9.0, 273.15 - 32*5.0/9.0, false},
+
+	// derived
+	{"mph", dimSpeed, 1609.344 / 3600, 0, false},
+	{"N", dimForce, 1, 0, true},
+	{"J", dimEnergy, 1, 0, true},
+	{"cal", dimEnergy, 4.184, 0, true},
+	{"W", dimPower, 1, 0, true},
+	{"Pa", dimPressure, 1, 0, true},
+	{"psi", dimPressure, 6894.757293168, 0, false},
+	{"A", dimElecCurrent, 1, 0, true},
+	{"mol", dimSubstance, 1, 0, true},
+	{"cd", dimLuminous, 1, 0, false},
+}
+
+// unitRegistry holds every unit by name including prefixed units
+var unitRegistry = make(map[string]unitDef)
+
+func init() {
+	for _, d := range unitDefs {
+		registerUnit(unitDef{d.name, d.dim, d.factor, d.offset})
+	}
+
+	// prefixed units never replace an explicitly defined unit
+	for _, d := range unitDefs {
+		if !d.prefixable {
+			continue
+		}
+		for prefix, mult := range siPrefixes {
+			name := prefix + d.name
+			if _, found := unitRegistry[name]; found {
+				continue
+			}
+			registerUnit(unitDef{name, d.dim, d.factor * mult, d.offset})
+		}
+	}
+}
+
+func registerUnit(u unitDef) {
+	unitRegistry[u.name] = u
+}
+
+// lookupUnit resolves a unit by name, alias, plural or integer power, ex. "ft^2"
+func lookupUnit(name string) (unitDef, bool) {
+	if u, found := unitAlias[name]; found {
+		name = u
+	}
+	if u, found := unitRegistry[name]; found {
+		return u, true
+	}
+	if split := strings.SplitN(name, "^", 2); len(split) == 2 {
+		n, err := strconv.Atoi(split[1])
+		if err != nil || n == 0 {
+			return unitDef{}, false
+		}
+		u, found := lookupUnit(split[0])
+		if !found || u.offset != 0 {
+			return unitDef{}, false
+		}
+		return u.pow(n), true
+	}
+	if strings.HasSuffix(name, "s") {
+		return lookupUnit(strings.TrimSuffix(name, "s"))
+	}
+	return unitDef{}, false
+}
+
+// unitConversionExpr builds the conversion expression between two units of
+// the same dimension
+func unitConversionExpr(from, to unitDef) string {
+	if from.offset == 0 && to.offset == 0 {
+		return "a*" + formatFactor(from.factor/to.factor)
+	}
+	offset := from.offset - to.offset
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return "(a*" + formatFactor(from.factor) + sign + formatFactor(offset) +
+		")/" + formatFactor(to.factor)
+}
+
+func formatFactor(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// names for common dimensions used when reporting errors
+var dimensionNames = map[dimension]string{
+	dimNone:        "dimensionless",
+	dimLen:         "length",
+	dimArea:        "area",
+	dimVolume:      "volume",
+	dimWeight:      "mass",
+	dimDuration:    "time",
+	dimTemp:        "temperature",
+	dimFrequency:   "frequency",
+	dimSpeed:       "speed",
+	dimForce:       "force",
+	dimEnergy:      "energy",
+	dimPower:       "power",
+	dimPressure:    "pressure",
+	dimElecCurrent: "current",
+	dimSubstance:   "amount of substance",
+	dimLuminous:    "luminous intensity",
+	dimMoney:       "currency",
+}
+
+func (d dimension) String() string {
+	if name, found := dimensionNames[d]; found {
+		return name
+	}
+	symbols := [numBaseDims]string{"L", "M", "T", "Θ", "I", "N", "J", "¤"}
+	var parts []string
+	for i, pow := range d {
+		if pow != 0 {
+			parts = append(parts, symbols[i]+"^"+strconv.Itoa(pow))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// loadConfigUnits registers the units, aliases and material densities
+// declared within the config file, ex:
+//
+//	units:
+//	  scoop: 60 mL
+//	  board-foot: 144 in^3
+//	unit-aliases:
+//	  scoops: scoop
+//	densities: # g/mL unless units are provided
+//	  flour: 0.593
+//	  resin: 1.1 g/mL
+//
+// Note that config keys are case insensitive and are read as lowercase.
+func loadConfigUnits() error {
+	for alias, unit := range viper.GetStringMapString("unit-aliases") {
+		unitAlias[alias] = unit
+	}
+
+	// units may be defined in terms of one another so keep registering until
+	// no more progress can be made
+	pending := viper.GetStringMapString("units")
+	for len(pending) > 0 {
+		var lastErr error
+		progress := false
+		for name, defStr := range pending {
+			q, err := evalUnitExpr(defStr)
+			if err != nil {
+				lastErr = fmt.Errorf("bad config unit %v (%v): %v", name, defStr, err)
+				continue
+			}
+			ud, ok := q.units.def()
+			if !ok || ud.offset != 0 || !q.value.isExact() {
+				lastErr = fmt.Errorf("bad config unit %v (%v): must be a multiple of a unit", name, defStr)
+				continue
+			}
+			registerUnit(unitDef{name, ud.dim, q.value.lo * ud.factor, 0})
+			delete(pending, name)
+			progress = true
+		}
+		if !progress {
+			return lastErr
+		}
+	}
+
+	gPerML := units{"g": 1, "mL": -1}
+	for material, densityStr := range viper.GetStringMapString("densities") {
+		density, err := strconv.ParseFloat(densityStr, 64)
+		if err == nil {
+			densities[material] = density
+			continue
+		}
+		q, err := evalUnitExpr(densityStr)
+		if err != nil {
+			return fmt.Errorf("bad config density %v (%v): %v", material, densityStr, err)
+		}
+		q, err = convertQuantity(q, gPerML)
+		if err == nil && !q.value.isExact() {
+			err = errors.New("must be a precise amount")
+		}
+		if err != nil {
+			return fmt.Errorf("bad config density %v (%v): %v", material, densityStr, err)
+		}
+		densities[material] = q.value.lo
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// passphrase encrypted password vault
+var (
+	VaultCmd = &cobra.Command{
+		Use:   "vault",
+		Short: "passphrase encrypted store of passwords",
+		Long: `passphrase encrypted store of passwords
+
+Entries are kept in $HOME/.multitool_vault unless --file is set, encrypted
+with AES-256-GCM under a key derived from the passphrase with argon2id. The
+passphrase is prompted for unless $MT_PASSPHRASE is set. Passwords copied to
+the clipboard are cleared after --clear seconds, the command waits until then
+(or an interrupt).`,
+	}
+
+	VaultAddCmd = &cobra.Command{
+		Use:   "add [name] [length] [chset]",
+		Short: "generate a password (as with \"mt pw\") and add it to the vault",
+		Args:  cobra.RangeArgs(1, 3),
+		RunE:  vaultAddCmd,
+	}
+
+	VaultGetCmd = &cobra.Command{
+		Use:   "get [name]",
+		Short: "copy the password of an entry",
+		Args:  cobra.ExactArgs(1),
+		RunE:  vaultGetCmd,
+	}
+
+	VaultListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "list the entries of the vault",
+		Args:  cobra.NoArgs,
+		RunE:  vaultListCmd,
+	}
+
+	VaultRmCmd = &cobra.Command{
+		Use:   "rm [name]",
+		Short: "remove an entry from the vault",
+		Args:  cobra.ExactArgs(1),
+		RunE:  vaultRmCmd,
+	}
+)
+
+var (
+	vaultIO           textIO
+	vaultFileFromFlag string
+	clearFromFlag     int
+	userFromFlag      string
+	noteFromFlag      string
+	promptFromFlag    bool
+	forceFromFlag     bool
+)
+
+// vaultDefaultLen is the length of generated passwords without a length
+// argument or --min-entropy
+const vaultDefaultLen = 20
+
+func init() {
+	VaultCmd.PersistentFlags().StringVar(&vaultFileFromFlag, "file", "",
+		"encrypted vault file (default $HOME/.multitool_vault)")
+	VaultCmd.PersistentFlags().IntVar(&clearFromFlag, "clear", 45,
+		"seconds after which the clipboard is cleared, 0 to leave it")
+	addTextIOFlags(VaultCmd, &vaultIO, false)
+
+	addPWPolicyFlags(VaultAddCmd)
+	VaultAddCmd.Flags().Float64Var(&minEntropyFromFlag, "min-entropy", 0,
+		"minimum bits of entropy, errors if the length falls short")
+	VaultAddCmd.Flags().StringVar(&userFromFlag, "user", "",
+		"username of the entry")
+	VaultAddCmd.Flags().StringVar(&noteFromFlag, "note", "",
+		"note of the entry, ex. the site")
+	VaultAddCmd.Flags().BoolVar(&promptFromFlag, "prompt", false,
+		"enter an existing password rather than generating one")
+	VaultAddCmd.Flags().BoolVarP(&forceFromFlag, "force", "f", false,
+		"replace an existing entry of the same name")
+
+	VaultCmd.AddCommand(VaultAddCmd, VaultGetCmd, VaultListCmd, VaultRmCmd)
+	RootCmd.AddCommand(VaultCmd)
+}
+
+// vaultEntry is a password and its details
+type vaultEntry struct {
+	Password string    `json:"password"`
+	User     string    `json:"user,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// vaultStore is the encrypted vault file
+type vaultStore struct {
+	file    *secretFile
+	entries map[string]vaultEntry
+}
+
+func loadVault() (*vaultStore, error) {
+	file, err := newSecretFile(vaultFileFromFlag, ".multitool_vault")
+	if err != nil {
+		return nil, err
+	}
+	v := &vaultStore{file: file, entries: make(map[string]vaultEntry)}
+	if err := file.load(&v.entries); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *vaultStore) save() error {
+	return v.file.save(v.entries)
+}
+
+// copyPassword writes the password and clears the clipboard after the
+// timeout
+func copyPassword(name, pw string) error {
+	if err := vaultIO.write(pw); err != nil {
+		return err
+	}
+	timeout := time.Duration(clearFromFlag) * time.Second
+	if timeout > 0 && vaultIO.destination() == "clipboard" {
+		vaultIO.status("pw of %v added to clipboard, clearing in %v", name, timeout)
+		return vaultIO.clearAfter(pw, timeout)
+	}
+	vaultIO.status("pw of %v added to %v", name, vaultIO.destination())
+	return nil
+}
+
+func vaultAddCmd(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	vault, err := loadVault()
+	if err != nil {
+		return err
+	}
+	if _, ok := vault.entries[name]; ok && !forceFromFlag {
+		return fmt.Errorf("%v is already in the vault, use --force to replace it", name)
+	}
+
+	var pw string
+	if promptFromFlag {
+		if len(args) > 1 {
+			return errors.New("a length can't be provided with --prompt")
+		}
+		bz, err := readHidden(fmt.Sprintf("pw of %v: ", name))
+		if err != nil {
+			return err
+		}
+		if len(bz) == 0 {
+			return errors.New("the pw can't be empty")
+		}
+		pw = string(bz)
+	} else {
+		var pwLen int
+		var bits float64
+		pw, pwLen, bits, err = generatePW(args[1:], vaultDefaultLen)
+		if err != nil {
+			return err
+		}
+		vaultIO.status("generated pw of %v (%d characters, %.1f bits of entropy)", name, pwLen, bits)
+	}
+
+	vault.entries[name] = vaultEntry{
+		Password: pw,
+		User:     userFromFlag,
+		Note:     noteFromFlag,
+		Updated:  time.Now(),
+	}
+	if err := vault.save(); err != nil {
+		return err
+	}
+	vaultIO.status("added %v to %v", name, vault.file.path)
+	return copyPassword(name, pw)
+}
+
+func vaultGetCmd(cmd *cobra.Command, args []string) error {
+	vault, err := loadVault()
+	if err != nil {
+		return err
+	}
+	entry, ok := vault.entries[args[0]]
+	if !ok {
+		return fmt.Errorf("no entry named %v in the vault", args[0])
+	}
+	if entry.User != "" {
+		vaultIO.status("user: %v", entry.User)
+	}
+	return copyPassword(args[0], entry.Password)
+}
+
+func vaultListCmd(cmd *cobra.Command, args []string) error {
+	vault, err := loadVault()
+	if err != nil {
+		return err
+	}
+	if len(vault.entries) == 0 {
+		fmt.Println("the vault is empty, add entries with \"mt vault add\"")
+		return nil
+	}
+	var names []string
+	for name := range vault.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := vault.entries[name]
+		fmt.Printf("%-30s %-20s %v", name, entry.User, entry.Updated.Format("2006-01-02"))
+		if entry.Note != "" {
+			fmt.Printf("  %v", entry.Note)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func vaultRmCmd(cmd *cobra.Command, args []string) error {
+	vault, err := loadVault()
+	if err != nil {
+		return err
+	}
+	if _, ok := vault.entries[args[0]]; !ok {
+		return fmt.Errorf("no entry named %v in the vault", args[0])
+	}
+	delete(vault.entries, args[0])
+	if err := vault.save(); err != nil {
+		return err
+	}
+	fmt.Printf("removed %v from %v\n", args[0], vault.file.path)
+	return nil
+}
@@ -1,6 +1,6 @@
 module github.com/rigelrozanski/multitool
 
-go 1.12
+go 1.15
 
 require (
 	github.com/atotto/clipboard v0.1.2
@@ -17,7 +17,11 @@ require (
 	github.com/spf13/viper v1.6.2
 	github.com/stretchr/testify v1.6.1
 	github.com/youpy/go-wav v0.3.0
-	golang.org/x/net v0.0.0-20210410081132-afb366fc7cd1
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/image v0.0.0-20191214001246-9130b4cfad52
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
 	google.golang.org/api v0.17.0
+	gopkg.in/yaml.v2 v2.2.4
 )